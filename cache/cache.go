@@ -0,0 +1,26 @@
+package cache
+
+import "time"
+
+// Cache stores encoded values under string keys. Implementations must be safe for concurrent use.
+// Values are plain bytes so a network store, like Redis, can implement the interface as well.
+type Cache interface {
+	// Get returns the value stored under key, if any and not expired
+	Get(key string) ([]byte, bool)
+	// Set stores value under key for ttl, a ttl of 0 never expires
+	Set(key string, value []byte, ttl time.Duration)
+	// Delete removes the given keys
+	Delete(keys ...string)
+	// DeletePrefix removes every key starting with prefix
+	DeletePrefix(prefix string)
+	// Stats returns the usage counters of the cache
+	Stats() Stats
+}
+
+// Stats holds the usage counters of a cache
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+}
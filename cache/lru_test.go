@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLRUGetSet(t *testing.T) {
+	c := NewLRU(10)
+
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Get() of a missing key found a value")
+	}
+
+	c.Set("a", []byte("1"), 0)
+	if got, ok := c.Get("a"); !ok || string(got) != "1" {
+		t.Errorf("Get() = %q, %v, want 1, true", got, ok)
+	}
+
+	c.Set("a", []byte("2"), 0)
+	if got, ok := c.Get("a"); !ok || string(got) != "2" {
+		t.Errorf("Get() after an overwrite = %q, %v, want 2, true", got, ok)
+	}
+
+	c.Delete("a", "missing")
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Get() of a deleted key found a value")
+	}
+
+	want := Stats{Hits: 2, Misses: 2, Entries: 0}
+	if got := c.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	c := NewLRU(10)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	c.Set("short", []byte("1"), time.Minute)
+	c.Set("forever", []byte("2"), 0)
+
+	now = now.Add(time.Minute)
+	if _, ok := c.Get("short"); !ok {
+		t.Errorf("Get() at the expiry time found no value")
+	}
+
+	now = now.Add(time.Second)
+	if _, ok := c.Get("short"); ok {
+		t.Errorf("Get() after the expiry time found a value")
+	}
+	if _, ok := c.Get("forever"); !ok {
+		t.Errorf("Get() of a key without ttl found no value")
+	}
+
+	// the expired entry is dropped by the read that found it
+	want := Stats{Hits: 2, Misses: 1, Entries: 1}
+	if got := c.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	c := NewLRU(3)
+	c.Set("a", []byte("1"), 0)
+	c.Set("b", []byte("2"), 0)
+	c.Set("c", []byte("3"), 0)
+
+	// reading a makes b the least recently used entry
+	c.Get("a")
+	c.Set("d", []byte("4"), 0)
+	// overwriting c makes a the least recently used entry
+	c.Set("c", []byte("5"), 0)
+	c.Set("e", []byte("6"), 0)
+
+	for key, want := range map[string]bool{"a": false, "b": false, "c": true, "d": true, "e": true} {
+		if _, ok := c.Get(key); ok != want {
+			t.Errorf("Get(%q) found a value: %v, want %v", key, ok, want)
+		}
+	}
+
+	if got := c.Stats(); got.Evictions != 2 || got.Entries != 3 {
+		t.Errorf("Stats() = %+v, want 2 evictions and 3 entries", got)
+	}
+}
+
+func TestLRUMinimumCapacity(t *testing.T) {
+	c := NewLRU(0)
+	c.Set("a", []byte("1"), 0)
+	c.Set("b", []byte("2"), 0)
+
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Get() of an evicted key found a value")
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Errorf("Get() of the last key found no value")
+	}
+}
+
+func TestLRUDeletePrefix(t *testing.T) {
+	c := NewLRU(10)
+	for _, key := range []string{"movie:1:detail", "movie:1:lastmod", "movie:12:detail", "movies:latest", "genres:all"} {
+		c.Set(key, []byte("x"), 0)
+	}
+
+	c.DeletePrefix("movie:1:")
+
+	for key, want := range map[string]bool{
+		"movie:1:detail":  false,
+		"movie:1:lastmod": false,
+		"movie:12:detail": true,
+		"movies:latest":   true,
+		"genres:all":      true,
+	} {
+		if _, ok := c.Get(key); ok != want {
+			t.Errorf("Get(%q) found a value: %v, want %v", key, ok, want)
+		}
+	}
+}
+
+func TestLRUConcurrent(t *testing.T) {
+	c := NewLRU(50)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := fmt.Sprintf("movie:%d:detail", j%100)
+				if j%3 == 0 {
+					c.Set(key, []byte{byte(i)}, time.Minute)
+				} else {
+					c.Get(key)
+				}
+				if j%250 == 0 {
+					c.DeletePrefix("movie:1")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := c.Stats()
+	if stats.Entries > 50 {
+		t.Errorf("the cache holds %d entries, over its capacity of 50", stats.Entries)
+	}
+	// 666 of the 1000 iterations of every goroutine read a key
+	if got := stats.Hits + stats.Misses; got != 8*666 {
+		t.Errorf("the cache counted %d reads, want %d", got, 8*666)
+	}
+}
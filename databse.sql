@@ -125,4 +125,259 @@ CREATE TABLE images (
 );
 
 -- Alter table movies add column image
-ALTER TABLE movies ADD COLUMN image varchar(255);
\ No newline at end of file
+ALTER TABLE movies ADD COLUMN image varchar(255);
+
+-- Create tags table inside the database
+CREATE TABLE tags (
+    id serial not null primary key,
+    name varchar(100) not null,
+    slug varchar(120) not null unique,
+    created_at timestamp,
+    updated_at timestamp
+);
+
+-- Create Join table for movies and tags
+CREATE TABLE movies_tags (
+    id serial not null primary key,
+    movie_id integer not null,
+    tag_id integer not null,
+    created_at timestamp,
+    updated_at timestamp,
+    CONSTRAINT movies_tags_movie_tag_key
+      UNIQUE (movie_id, tag_id),
+    CONSTRAINT fk_movie_id
+      FOREIGN KEY(movie_id)
+      REFERENCES movies(id)
+      ON DELETE CASCADE,
+    CONSTRAINT fk_tag_id
+      FOREIGN KEY(tag_id)
+      REFERENCES tags(id)
+      ON DELETE CASCADE
+);
+
+-- Alter table genres add column parent_id for sub-genres
+ALTER TABLE genres ADD COLUMN parent_id integer REFERENCES genres (id) ON DELETE SET NULL;
+
+-- Genre names are unique whatever their case
+CREATE UNIQUE INDEX genres_genre_name_lower_key ON genres (LOWER(genre_name));
+
+-- One rating per user and movie, rating submissions upsert on it
+DELETE FROM ratings a USING ratings b
+WHERE a.movie_id = b.movie_id AND a.user_id = b.user_id AND a.id < b.id;
+
+ALTER TABLE ratings ADD CONSTRAINT ratings_movie_id_user_id_key UNIQUE (movie_id, user_id);
+
+-- Movies a user wants to watch
+CREATE TABLE watchlist (
+    id serial not null primary key,
+    user_id integer not null,
+    movie_id integer not null,
+    created_at timestamp,
+    updated_at timestamp,
+    CONSTRAINT watchlist_user_movie_key
+      UNIQUE (user_id, movie_id),
+    CONSTRAINT fk_user_id
+      FOREIGN KEY(user_id)
+      REFERENCES users(id)
+      ON DELETE CASCADE,
+    CONSTRAINT fk_movie_id
+      FOREIGN KEY(movie_id)
+      REFERENCES movies(id)
+      ON DELETE CASCADE
+);
+
+-- Long-form reviews, one per user and movie, optionally linked to the rating of the author
+CREATE TABLE reviews (
+    id serial not null primary key,
+    movie_id integer not null,
+    user_id integer not null,
+    rating_id integer,
+    title varchar(255) not null,
+    body text not null,
+    spoiler boolean not null default false,
+    created_at timestamp,
+    updated_at timestamp,
+    CONSTRAINT reviews_movie_user_key
+      UNIQUE (movie_id, user_id),
+    CONSTRAINT fk_movie_id
+      FOREIGN KEY(movie_id)
+      REFERENCES movies(id)
+      ON DELETE CASCADE,
+    CONSTRAINT fk_user_id
+      FOREIGN KEY(user_id)
+      REFERENCES users(id)
+      ON DELETE CASCADE,
+    CONSTRAINT fk_rating_id
+      FOREIGN KEY(rating_id)
+      REFERENCES ratings(id)
+      ON DELETE SET NULL
+);
+
+-- Helpful votes on reviews, one per user and review
+CREATE TABLE review_votes (
+    id serial not null primary key,
+    review_id integer not null,
+    user_id integer not null,
+    created_at timestamp,
+    updated_at timestamp,
+    CONSTRAINT review_votes_review_user_key
+      UNIQUE (review_id, user_id),
+    CONSTRAINT fk_review_id
+      FOREIGN KEY(review_id)
+      REFERENCES reviews(id)
+      ON DELETE CASCADE,
+    CONSTRAINT fk_user_id
+      FOREIGN KEY(user_id)
+      REFERENCES users(id)
+      ON DELETE CASCADE
+);
+
+-- Threaded replies, depth is 0 for top level comments. A deleted comment with replies keeps its row
+-- with deleted_at set and is shown as "[deleted]"
+ALTER TABLE comments
+    ADD COLUMN parent_id integer,
+    ADD COLUMN depth integer not null default 0,
+    ADD COLUMN deleted_at timestamp,
+    ADD CONSTRAINT fk_parent_id
+      FOREIGN KEY(parent_id)
+      REFERENCES comments(id)
+      ON DELETE CASCADE;
+
+CREATE INDEX comments_parent_id_idx ON comments (parent_id);
+
+-- Reactions on comments, one per user and comment
+CREATE TABLE comment_reactions (
+    id serial not null primary key,
+    comment_id integer not null,
+    user_id integer not null,
+    reaction varchar(20) not null,
+    created_at timestamp,
+    updated_at timestamp,
+    CONSTRAINT comment_reactions_comment_user_key
+      UNIQUE (comment_id, user_id),
+    CONSTRAINT fk_comment_id
+      FOREIGN KEY(comment_id)
+      REFERENCES comments(id)
+      ON DELETE CASCADE,
+    CONSTRAINT fk_user_id
+      FOREIGN KEY(user_id)
+      REFERENCES users(id)
+      ON DELETE CASCADE
+);
+
+-- Publication status of user content, pending content waits for a moderator and is not listed
+ALTER TABLE comments ADD COLUMN status varchar(20) not null default 'published';
+ALTER TABLE reviews ADD COLUMN status varchar(20) not null default 'published';
+
+-- Suspended users can't log in
+ALTER TABLE users ADD COLUMN suspended boolean not null default false;
+
+-- Reports of users about comments, reviews or other users, a user reports a target once
+CREATE TABLE reports (
+    id serial not null primary key,
+    reporter_id integer not null,
+    target_type varchar(20) not null,
+    target_id integer not null,
+    reason varchar(20) not null,
+    details text not null default '',
+    status varchar(20) not null default 'open',
+    created_at timestamp,
+    updated_at timestamp,
+    CONSTRAINT reports_reporter_target_key
+      UNIQUE (reporter_id, target_type, target_id),
+    CONSTRAINT fk_reporter_id
+      FOREIGN KEY(reporter_id)
+      REFERENCES users(id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX reports_status_idx ON reports (status, created_at);
+
+-- Every decision of a moderator, on a report or directly on a user
+CREATE TABLE moderation_actions (
+    id serial not null primary key,
+    report_id integer,
+    moderator_id integer not null,
+    action varchar(20) not null,
+    target_type varchar(20) not null,
+    target_id integer not null,
+    note text not null default '',
+    created_at timestamp,
+    CONSTRAINT fk_report_id
+      FOREIGN KEY(report_id)
+      REFERENCES reports(id)
+      ON DELETE SET NULL,
+    CONSTRAINT fk_moderator_id
+      FOREIGN KEY(moderator_id)
+      REFERENCES users(id)
+      ON DELETE CASCADE
+);
+
+-- Inbox of the users, read_at is null while unread
+CREATE TABLE notifications (
+    id serial not null primary key,
+    user_id integer not null,
+    type varchar(30) not null,
+    actor_id integer,
+    movie_id integer,
+    comment_id integer,
+    message text not null,
+    read_at timestamp,
+    created_at timestamp,
+    CONSTRAINT fk_user_id
+      FOREIGN KEY(user_id)
+      REFERENCES users(id)
+      ON DELETE CASCADE,
+    CONSTRAINT fk_actor_id
+      FOREIGN KEY(actor_id)
+      REFERENCES users(id)
+      ON DELETE SET NULL,
+    CONSTRAINT fk_movie_id
+      FOREIGN KEY(movie_id)
+      REFERENCES movies(id)
+      ON DELETE CASCADE,
+    CONSTRAINT fk_comment_id
+      FOREIGN KEY(comment_id)
+      REFERENCES comments(id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX notifications_user_id_idx ON notifications (user_id, created_at);
+
+-- Notification types a user opted out of, a missing row means enabled
+CREATE TABLE notification_preferences (
+    user_id integer not null,
+    type varchar(30) not null,
+    enabled boolean not null default true,
+    updated_at timestamp,
+    PRIMARY KEY (user_id, type),
+    CONSTRAINT fk_user_id
+      FOREIGN KEY(user_id)
+      REFERENCES users(id)
+      ON DELETE CASCADE
+);
+
+-- Writing or deleting a row shown with a movie bumps movies.updated_at in the same transaction,
+-- the Last-Modified header of the movie endpoints is derived from it
+CREATE OR REPLACE FUNCTION touch_movie() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        UPDATE movies SET updated_at = now() WHERE id = OLD.movie_id;
+    END IF;
+    IF TG_OP = 'INSERT' OR (TG_OP = 'UPDATE' AND NEW.movie_id <> OLD.movie_id) THEN
+        UPDATE movies SET updated_at = now() WHERE id = NEW.movie_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ratings_touch_movie AFTER INSERT OR UPDATE OR DELETE ON ratings
+    FOR EACH ROW EXECUTE FUNCTION touch_movie();
+CREATE TRIGGER favorites_touch_movie AFTER INSERT OR UPDATE OR DELETE ON favorites
+    FOR EACH ROW EXECUTE FUNCTION touch_movie();
+CREATE TRIGGER comments_touch_movie AFTER INSERT OR UPDATE OR DELETE ON comments
+    FOR EACH ROW EXECUTE FUNCTION touch_movie();
+CREATE TRIGGER movies_genres_touch_movie AFTER INSERT OR UPDATE OR DELETE ON movies_genres
+    FOR EACH ROW EXECUTE FUNCTION touch_movie();
+CREATE TRIGGER movies_tags_touch_movie AFTER INSERT OR UPDATE OR DELETE ON movies_tags
+    FOR EACH ROW EXECUTE FUNCTION touch_movie();
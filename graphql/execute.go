@@ -0,0 +1,574 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Request is a GraphQL request as sent over http
+type Request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+}
+
+// Error is an error of a request, with the path of the field that failed
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Response is the result of a request. Data is left out when the request failed
+// before execution started, like on a syntax error or a query over the limits.
+type Response struct {
+	Data   *OrderedMap `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// OrderedMap is a JSON object which keeps its keys in the order of the selection set
+type OrderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newOrderedMap() *OrderedMap {
+	return &OrderedMap{values: make(map[string]interface{})}
+}
+
+// Set sets the value of a key, new keys are appended
+func (m *OrderedMap) Set(key string, value interface{}) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// Get returns the value of a key
+func (m *OrderedMap) Get(key string) interface{} {
+	return m.values[key]
+}
+
+func (m *OrderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// RequestError reports whether the response failed before execution started
+func (r *Response) RequestError() bool {
+	return r.Data == nil && len(r.Errors) > 0
+}
+
+// Execute parses, validates and runs a request against the schema
+func (s *Schema) Execute(ctx context.Context, req Request) *Response {
+	doc, err := Parse(req.Query)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if op.Type != "query" {
+		return errorResponse(fmt.Errorf("%s operations are not supported", op.Type))
+	}
+
+	vars, err := variableValues(op, req.Variables)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	e := &executor{schema: s, doc: doc, vars: vars, ctx: ctx}
+
+	complexity, err := e.validate(s.Query, op.Selections, 1, map[string]bool{})
+	if err != nil {
+		return errorResponse(err)
+	}
+	if s.MaxComplexity > 0 && complexity > s.MaxComplexity {
+		return errorResponse(fmt.Errorf("query has a complexity of %d, the maximum allowed is %d", complexity, s.MaxComplexity))
+	}
+
+	data := e.selectionSet(s.Query, []interface{}{nil}, op.Selections, nil)
+	return &Response{Data: data[0], Errors: e.errors}
+}
+
+func errorResponse(err error) *Response {
+	return &Response{Errors: []*Error{{Message: err.Error()}}}
+}
+
+// operation picks the operation to run from the document
+func (d *Document) operation(name string) (*Operation, error) {
+	if name == "" {
+		if len(d.Operations) > 1 {
+			return nil, fmt.Errorf("operationName is required when the document contains several operations")
+		}
+		return d.Operations[0], nil
+	}
+
+	for _, op := range d.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+// variableValues applies the defaults of the operation variables and checks the required ones are given
+func variableValues(op *Operation, given map[string]interface{}) (map[string]interface{}, error) {
+	vars := make(map[string]interface{}, len(op.Variables))
+	for _, def := range op.Variables {
+		value, ok := given[def.Name]
+		if !ok {
+			value = def.Default
+		}
+		if value == nil && strings.HasSuffix(def.Type, "!") {
+			return nil, fmt.Errorf("variable $%s of type %s is required", def.Name, def.Type)
+		}
+		vars[def.Name] = value
+	}
+	return vars, nil
+}
+
+type executor struct {
+	schema *Schema
+	doc    *Document
+	vars   map[string]interface{}
+	ctx    context.Context
+	errors []*Error
+}
+
+// fieldGroup is the set of field nodes sharing a response key, their selection sets are merged
+type fieldGroup struct {
+	key   string
+	nodes []*FieldNode
+}
+
+func (g *fieldGroup) selections() []Selection {
+	var selections []Selection
+	for _, node := range g.nodes {
+		selections = append(selections, node.Selections...)
+	}
+	return selections
+}
+
+// collectFields flattens the fragments of a selection set and groups its fields by response key
+func (e *executor) collectFields(obj *Object, selections []Selection, groups []*fieldGroup, visited map[string]bool) ([]*fieldGroup, error) {
+	for _, selection := range selections {
+		switch sel := selection.(type) {
+		case *FieldNode:
+			include, err := e.included(sel.Directives)
+			if err != nil {
+				return nil, err
+			}
+			if !include {
+				continue
+			}
+			found := false
+			for _, group := range groups {
+				if group.key == sel.ResponseKey() {
+					if group.nodes[0].Name != sel.Name {
+						return nil, fmt.Errorf("fields %q and %q conflict because they have the same response key", group.nodes[0].Name, sel.Name)
+					}
+					group.nodes = append(group.nodes, sel)
+					found = true
+					break
+				}
+			}
+			if !found {
+				groups = append(groups, &fieldGroup{key: sel.ResponseKey(), nodes: []*FieldNode{sel}})
+			}
+		case *InlineFragment:
+			include, err := e.included(sel.Directives)
+			if err != nil {
+				return nil, err
+			}
+			if !include || (sel.TypeCondition != "" && sel.TypeCondition != obj.Name) {
+				continue
+			}
+			groups, err = e.collectFields(obj, sel.Selections, groups, visited)
+			if err != nil {
+				return nil, err
+			}
+		case *FragmentSpread:
+			include, err := e.included(sel.Directives)
+			if err != nil {
+				return nil, err
+			}
+			fragment, ok := e.doc.Fragments[sel.Name]
+			if !ok {
+				return nil, fmt.Errorf("unknown fragment %q", sel.Name)
+			}
+			if !include || fragment.TypeCondition != obj.Name {
+				continue
+			}
+			if visited[sel.Name] {
+				return nil, fmt.Errorf("fragment %q spreads itself", sel.Name)
+			}
+			visited[sel.Name] = true
+			groups, err = e.collectFields(obj, fragment.Selections, groups, visited)
+			delete(visited, sel.Name)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return groups, nil
+}
+
+// included evaluates the @skip and @include directives of a selection
+func (e *executor) included(directives []*Directive) (bool, error) {
+	for _, directive := range directives {
+		if directive.Name != "skip" && directive.Name != "include" {
+			continue
+		}
+		value, err := Boolean.Coerce(e.value(directive.Arguments["if"]))
+		if err != nil {
+			return false, fmt.Errorf("@%s: %v", directive.Name, err)
+		}
+		if value.(bool) == (directive.Name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// value replaces the variables of an argument value with their values
+func (e *executor) value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case Variable:
+		return e.vars[string(v)]
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = e.value(item)
+		}
+		return list
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			object[key] = e.value(item)
+		}
+		return object
+	}
+	return v
+}
+
+// arguments coerces the arguments of a field into the values its resolver expects
+func (e *executor) arguments(name string, field *Field, node *FieldNode) (map[string]interface{}, error) {
+	for arg := range node.Arguments {
+		if _, ok := field.Args[arg]; !ok {
+			return nil, fmt.Errorf("unknown argument %q on field %q", arg, name)
+		}
+	}
+
+	args := make(map[string]interface{}, len(field.Args))
+	for arg, def := range field.Args {
+		value := e.value(node.Arguments[arg])
+		if value == nil {
+			value = def.Default
+		}
+		if value == nil {
+			if def.Required {
+				return nil, fmt.Errorf("argument %q of field %q is required", arg, name)
+			}
+			continue
+		}
+		coerced, err := coerce(def.Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("argument %q of field %q: %v", arg, name, err)
+		}
+		args[arg] = coerced
+	}
+	return args, nil
+}
+
+func coerce(t Type, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch t := t.(type) {
+	case *Scalar:
+		return t.Coerce(value)
+	case *List:
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			var err error
+			list[i], err = coerce(t.Of, item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("%s cannot be used as an input type", t)
+}
+
+// validate checks the fields and arguments of a selection set against the schema
+// and the depth limit, and returns the complexity of the selection set
+func (e *executor) validate(obj *Object, selections []Selection, depth int, visited map[string]bool) (int, error) {
+	if e.schema.MaxDepth > 0 && depth > e.schema.MaxDepth {
+		return 0, fmt.Errorf("query is nested deeper than the maximum depth of %d", e.schema.MaxDepth)
+	}
+
+	groups, err := e.collectFields(obj, selections, nil, visited)
+	if err != nil {
+		return 0, err
+	}
+
+	complexity := 0
+	for _, group := range groups {
+		node := group.nodes[0]
+		if node.Name == "__typename" {
+			continue
+		}
+
+		field, ok := obj.Fields[node.Name]
+		if !ok {
+			return 0, fmt.Errorf("cannot query field %q on type %q", node.Name, obj.Name)
+		}
+
+		args, err := e.arguments(node.Name, field, node)
+		if err != nil {
+			return 0, err
+		}
+
+		// the limit drives the complexity, a negative one would let a query slip under MaxComplexity
+		if limit, ok := args["limit"].(int); ok {
+			if limit < 1 && e.schema.MaxListSize == 0 {
+				return 0, fmt.Errorf("limit of field %q must be greater than zero", node.Name)
+			}
+			if limit < 1 || (e.schema.MaxListSize > 0 && limit > e.schema.MaxListSize) {
+				return 0, fmt.Errorf("limit of field %q must be between 1 and %d", node.Name, e.schema.MaxListSize)
+			}
+		}
+
+		childComplexity := 0
+		child, list := namedType(field.Type)
+		if childObj, ok := child.(*Object); ok {
+			if len(group.selections()) == 0 {
+				return 0, fmt.Errorf("field %q of type %s must have a selection of subfields", node.Name, field.Type)
+			}
+			childComplexity, err = e.validate(childObj, group.selections(), depth+1, visited)
+			if err != nil {
+				return 0, err
+			}
+		} else if len(group.selections()) > 0 {
+			return 0, fmt.Errorf("field %q of type %s cannot have a selection of subfields", node.Name, field.Type)
+		}
+
+		if field.Complexity != nil {
+			complexity += field.Complexity(args, childComplexity)
+			continue
+		}
+
+		size := 1
+		if list {
+			size = e.schema.DefaultListSize
+			if limit, ok := args["limit"].(int); ok {
+				size = limit
+			}
+		}
+		complexity += 1 + size*childComplexity
+	}
+
+	return complexity, nil
+}
+
+// namedType unwraps the list types of t
+func namedType(t Type) (Type, bool) {
+	list := false
+	for {
+		l, ok := t.(*List)
+		if !ok {
+			return t, list
+		}
+		list = true
+		t = l.Of
+	}
+}
+
+// selectionSet resolves a selection set for all the parents at once, each field is
+// resolved with a single call for every parent which is what batching resolvers build on
+func (e *executor) selectionSet(obj *Object, parents []interface{}, selections []Selection, path []interface{}) []*OrderedMap {
+	results := make([]*OrderedMap, len(parents))
+	for i := range results {
+		results[i] = newOrderedMap()
+	}
+
+	// the selection set was validated already
+	groups, _ := e.collectFields(obj, selections, nil, map[string]bool{})
+
+	for _, group := range groups {
+		node := group.nodes[0]
+		fieldPath := append(append([]interface{}{}, path...), group.key)
+
+		if node.Name == "__typename" {
+			for _, result := range results {
+				result.Set(group.key, obj.Name)
+			}
+			continue
+		}
+
+		field := obj.Fields[node.Name]
+		args, _ := e.arguments(node.Name, field, node)
+
+		values, err := e.resolve(field, parents, args)
+		if err != nil {
+			e.errors = append(e.errors, &Error{Message: err.Error(), Path: fieldPath})
+			values = make([]interface{}, len(parents))
+		}
+
+		completed := e.complete(field.Type, values, group.selections(), fieldPath)
+		for i, result := range results {
+			result.Set(group.key, completed[i])
+		}
+	}
+
+	return results
+}
+
+func (e *executor) resolve(field *Field, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	if field.Batch != nil {
+		values, err := field.Batch(e.ctx, parents, args)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != len(parents) {
+			return nil, fmt.Errorf("resolver returned %d values for %d parents", len(values), len(parents))
+		}
+		return values, nil
+	}
+
+	values := make([]interface{}, len(parents))
+	for i, parent := range parents {
+		var err error
+		values[i], err = field.Resolve(e.ctx, parent, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// complete turns resolved values into response values, the items of all the lists
+// are completed together so nested fields are again resolved once per level
+func (e *executor) complete(t Type, values []interface{}, selections []Selection, path []interface{}) []interface{} {
+	completed := make([]interface{}, len(values))
+
+	switch t := t.(type) {
+	case *Scalar:
+		for i, value := range values {
+			value, ok := indirect(value)
+			if !ok {
+				continue
+			}
+			serialized, err := t.Serialize(value)
+			if err != nil {
+				e.errors = append(e.errors, &Error{Message: err.Error(), Path: path})
+				continue
+			}
+			completed[i] = serialized
+		}
+
+	case *Object:
+		var parents []interface{}
+		var index []int
+		for i, value := range values {
+			if isNil(value) {
+				continue
+			}
+			parents = append(parents, value)
+			index = append(index, i)
+		}
+		if len(parents) == 0 {
+			return completed
+		}
+		for i, result := range e.selectionSet(t, parents, selections, path) {
+			completed[index[i]] = result
+		}
+
+	case *List:
+		var items []interface{}
+		lengths := make([]int, len(values))
+		for i, value := range values {
+			if isNil(value) {
+				lengths[i] = -1
+				continue
+			}
+			v := reflect.ValueOf(value)
+			if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+				e.errors = append(e.errors, &Error{Message: fmt.Sprintf("expected a list for %s", t), Path: path})
+				lengths[i] = -1
+				continue
+			}
+			lengths[i] = v.Len()
+			for j := 0; j < v.Len(); j++ {
+				items = append(items, v.Index(j).Interface())
+			}
+		}
+
+		completedItems := e.complete(t.Of, items, selections, path)
+		offset := 0
+		for i, length := range lengths {
+			if length < 0 {
+				continue
+			}
+			completed[i] = completedItems[offset : offset+length]
+			offset += length
+		}
+	}
+
+	return completed
+}
+
+// indirect dereferences pointers, it returns false for nil values
+func indirect(value interface{}) (interface{}, bool) {
+	if isNil(value) {
+		return nil, false
+	}
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	return v.Interface(), true
+}
+
+func isNil(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,339 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testAuthor struct {
+	ID   int
+	Name string
+}
+
+type testBook struct {
+	ID       int
+	Title    string
+	AuthorID int
+}
+
+var (
+	testAuthors = []*testAuthor{{1, "Ann"}, {2, "Bob"}}
+	testBooks   = []*testBook{{1, "Dune", 1}, {2, "Emma", 2}, {3, "Faust", 1}}
+)
+
+// testSchema is a small library schema, authorBatches records the number of parents of every author batch
+func testSchema(authorBatches *[]int) *Schema {
+	book := &Object{Name: "Book"}
+	author := &Object{Name: "Author"}
+
+	book.Fields = map[string]*Field{
+		"id": {Type: ID, Resolve: func(_ context.Context, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return parent.(*testBook).ID, nil
+		}},
+		"title": {Type: String, Resolve: func(_ context.Context, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return parent.(*testBook).Title, nil
+		}},
+		"author": {Type: author, Batch: func(_ context.Context, parents []interface{}, _ map[string]interface{}) ([]interface{}, error) {
+			*authorBatches = append(*authorBatches, len(parents))
+			values := make([]interface{}, len(parents))
+			for i, parent := range parents {
+				for _, a := range testAuthors {
+					if a.ID == parent.(*testBook).AuthorID {
+						values[i] = a
+					}
+				}
+			}
+			return values, nil
+		}},
+	}
+
+	author.Fields = map[string]*Field{
+		"name": {Type: String, Resolve: func(_ context.Context, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return parent.(*testAuthor).Name, nil
+		}},
+		"books": {
+			Type: ListOf(book),
+			Args: map[string]*Argument{"limit": {Type: Int, Default: 2}},
+			Resolve: func(_ context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+				var books []*testBook
+				for _, b := range testBooks {
+					if b.AuthorID == parent.(*testAuthor).ID && len(books) < args["limit"].(int) {
+						books = append(books, b)
+					}
+				}
+				return books, nil
+			},
+		},
+	}
+
+	query := &Object{Name: "Query"}
+	query.Fields = map[string]*Field{
+		"book": {
+			Type: book,
+			Args: map[string]*Argument{"id": {Type: ID, Required: true}},
+			Resolve: func(_ context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+				for _, b := range testBooks {
+					if b.ID == args["id"].(int) {
+						return b, nil
+					}
+				}
+				return nil, nil
+			},
+		},
+		"books": {
+			Type: ListOf(book),
+			Args: map[string]*Argument{"limit": {Type: Int, Default: 2}},
+			Resolve: func(_ context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+				limit := args["limit"].(int)
+				if limit > len(testBooks) {
+					limit = len(testBooks)
+				}
+				return testBooks[:limit], nil
+			},
+		},
+		"fail": {Type: String, Resolve: func(context.Context, interface{}, map[string]interface{}) (interface{}, error) {
+			return nil, errors.New("boom")
+		}},
+	}
+
+	return &Schema{Query: query, MaxDepth: 4, MaxComplexity: 50, DefaultListSize: 10, MaxListSize: 5}
+}
+
+func marshal(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	return string(b)
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		operation string
+		want      string
+	}{
+		{
+			name:  "fields in selection order",
+			query: `{ book(id: 1) { title id } }`,
+			want:  `{"book":{"title":"Dune","id":"1"}}`,
+		},
+		{
+			name:  "unknown id",
+			query: `{ book(id: 9) { title } }`,
+			want:  `{"book":null}`,
+		},
+		{
+			name:  "aliases",
+			query: `{ first: book(id: 1) { name: title } second: book(id: "2") { title } }`,
+			want:  `{"first":{"name":"Dune"},"second":{"title":"Emma"}}`,
+		},
+		{
+			name:  "default argument",
+			query: `{ books { title } }`,
+			want:  `{"books":[{"title":"Dune"},{"title":"Emma"}]}`,
+		},
+		{
+			name:  "nested lists",
+			query: `{ books(limit: 3) { title author { name books(limit: 1) { id } } } }`,
+			want: `{"books":[{"title":"Dune","author":{"name":"Ann","books":[{"id":"1"}]}},` +
+				`{"title":"Emma","author":{"name":"Bob","books":[{"id":"2"}]}},` +
+				`{"title":"Faust","author":{"name":"Ann","books":[{"id":"1"}]}}]}`,
+		},
+		{
+			name:  "named fragments",
+			query: `{ book(id: 3) { ...BookFields } } fragment BookFields on Book { id ...Titled } fragment Titled on Book { title }`,
+			want:  `{"book":{"id":"3","title":"Faust"}}`,
+		},
+		{
+			name:  "fragments of another type are skipped",
+			query: `{ book(id: 3) { id ...AuthorFields ... on Author { name } } } fragment AuthorFields on Author { name }`,
+			want:  `{"book":{"id":"3"}}`,
+		},
+		{
+			name:  "inline fragments merge with the fields",
+			query: `{ book(id: 1) { author { name } ... on Book { title author { books { title } } } } }`,
+			want:  `{"book":{"author":{"name":"Ann","books":[{"title":"Dune"},{"title":"Faust"}]},"title":"Dune"}}`,
+		},
+		{
+			name:      "variables",
+			query:     `query ($id: ID!, $limit: Int = 1) { book(id: $id) { author { books(limit: $limit) { title } } } }`,
+			variables: map[string]interface{}{"id": "1"},
+			want:      `{"book":{"author":{"books":[{"title":"Dune"}]}}}`,
+		},
+		{
+			name:      "variables override defaults",
+			query:     `query ($limit: Int = 1) { books(limit: $limit) { id } }`,
+			variables: map[string]interface{}{"limit": float64(3)},
+			want:      `{"books":[{"id":"1"},{"id":"2"},{"id":"3"}]}`,
+		},
+		{
+			name:      "skip and include",
+			query:     `query ($yes: Boolean!) { book(id: 1) { id @skip(if: $yes) title @include(if: $yes) ... on Book @include(if: false) { author { name } } } }`,
+			variables: map[string]interface{}{"yes": true},
+			want:      `{"book":{"title":"Dune"}}`,
+		},
+		{
+			name:  "typename",
+			query: `{ __typename book(id: 2) { kind: __typename } }`,
+			want:  `{"__typename":"Query","book":{"kind":"Book"}}`,
+		},
+		{
+			name:      "operation name",
+			query:     `query One { book(id: 1) { id } } query Two { book(id: 2) { id } }`,
+			operation: "Two",
+			want:      `{"book":{"id":"2"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var batches []int
+			resp := testSchema(&batches).Execute(context.Background(), Request{Query: tt.query, Variables: tt.variables, OperationName: tt.operation})
+			if len(resp.Errors) > 0 {
+				t.Fatalf("Execute() errors = %s", marshal(t, resp.Errors))
+			}
+			if got := marshal(t, resp.Data); got != tt.want {
+				t.Errorf("Execute() data = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteBatchesEachLevel(t *testing.T) {
+	var batches []int
+	schema := testSchema(&batches)
+	schema.MaxDepth = 0
+	resp := schema.Execute(context.Background(), Request{Query: `{ books(limit: 3) { author { books { author { name } } } } }`})
+	if len(resp.Errors) > 0 {
+		t.Fatalf("Execute() errors = %s", marshal(t, resp.Errors))
+	}
+
+	// 3 books at the first level, then 2 + 1 + 2 books of their authors at the second
+	want := []int{3, 5}
+	if marshal(t, batches) != marshal(t, want) {
+		t.Errorf("author batches = %v, want %v", batches, want)
+	}
+}
+
+func TestExecuteResolverError(t *testing.T) {
+	var batches []int
+	resp := testSchema(&batches).Execute(context.Background(), Request{Query: `{ oops: fail book(id: 1) { title } }`})
+
+	if resp.RequestError() {
+		t.Fatalf("RequestError() = true, want the data of the other fields")
+	}
+	if got, want := marshal(t, resp.Data), `{"oops":null,"book":{"title":"Dune"}}`; got != want {
+		t.Errorf("Execute() data = %s, want %s", got, want)
+	}
+	if got, want := marshal(t, resp.Errors), `[{"message":"boom","path":["oops"]}]`; got != want {
+		t.Errorf("Execute() errors = %s, want %s", got, want)
+	}
+}
+
+func TestExecuteRequestErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		want      string
+	}{
+		{"syntax error", `{ book(id: 1) { title }`, nil, "syntax error"},
+		{"mutation", `mutation { book(id: 1) { title } }`, nil, "mutation operations are not supported"},
+		{"several operations", `query A { books { id } } query B { books { id } }`, nil, "operationName is required"},
+		{"unknown field", `{ book(id: 1) { isbn } }`, nil, `cannot query field "isbn" on type "Book"`},
+		{"unknown argument", `{ book(id: 1, isbn: 2) { title } }`, nil, `unknown argument "isbn"`},
+		{"missing argument", `{ book { title } }`, nil, `argument "id" of field "book" is required`},
+		{"invalid argument", `{ book(id: true) { title } }`, nil, "Int cannot represent true"},
+		{"missing variable", `query ($id: ID!) { book(id: $id) { title } }`, nil, "variable $id of type ID! is required"},
+		{"invalid variable", `query ($n: Int) { books(limit: $n) { id } }`, map[string]interface{}{"n": 1.5}, "Int cannot represent 1.5"},
+		{"object without selection", `{ book(id: 1) }`, nil, "must have a selection of subfields"},
+		{"scalar with selection", `{ book(id: 1) { title { length } } }`, nil, "cannot have a selection of subfields"},
+		{"unknown fragment", `{ book(id: 1) { ...Missing } }`, nil, `unknown fragment "Missing"`},
+		{"fragment cycle", `{ book(id: 1) { ...A } } fragment A on Book { ...B } fragment B on Book { ...A }`, nil, "spreads itself"},
+		{"conflicting aliases", `{ book(id: 1) { id: title id } }`, nil, "same response key"},
+		{"too deep", `{ books { author { books { author { name } } } } }`, nil, "maximum depth of 4"},
+		{"too complex", `{ books(limit: 5) { author { books(limit: 5) { id title } } } }`, nil, "complexity of 61, the maximum allowed is 50"},
+		{"limit over the maximum", `{ books(limit: 6) { id } }`, nil, `limit of field "books" must be between 1 and 5`},
+		{"zero limit", `{ books(limit: 0) { id } }`, nil, `limit of field "books" must be between 1 and 5`},
+		// a negative limit would make the complexity negative and hide the rest of the query
+		{"negative limit", `{ books(limit: -100) { author { books(limit: 5) { title } } } }`, nil, `limit of field "books" must be between 1 and 5`},
+		{"negative limit variable", `query ($n: Int) { books { author { books(limit: $n) { id } } } }`, map[string]interface{}{"n": -1}, `limit of field "books" must be between 1 and 5`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var batches []int
+			resp := testSchema(&batches).Execute(context.Background(), Request{Query: tt.query, Variables: tt.variables})
+			if !resp.RequestError() {
+				t.Fatalf("RequestError() = false, want an error containing %q, data = %s", tt.want, marshal(t, resp.Data))
+			}
+			if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, tt.want) {
+				t.Errorf("Execute() errors = %s, want one containing %q", marshal(t, resp.Errors), tt.want)
+			}
+			if len(batches) > 0 {
+				t.Errorf("resolvers ran for a request which failed validation")
+			}
+		})
+	}
+}
+
+func TestExecuteComplexity(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		complexityFn   ComplexityFn
+		maxComplexity  int
+		wantComplexity int
+	}{
+		// name 1, author 1+1 = 2, title 1, books 1+3*(2+1) = 10
+		{"limit argument", `{ books(limit: 3) { title author { name } } }`, nil, 9, 10},
+		// without a limit the default of the argument applies
+		{"default limit", `{ books { title } }`, nil, 2, 3},
+		{"custom complexity", `{ books(limit: 3) { title } }`, func(args map[string]interface{}, child int) int {
+			return 100 * args["limit"].(int) * child
+		}, 299, 300},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var batches []int
+			schema := testSchema(&batches)
+			schema.Query.Fields["books"].Complexity = tt.complexityFn
+
+			schema.MaxComplexity = tt.wantComplexity
+			if resp := schema.Execute(context.Background(), Request{Query: tt.query}); resp.RequestError() {
+				t.Fatalf("Execute() at the limit errors = %s", marshal(t, resp.Errors))
+			}
+
+			schema.MaxComplexity = tt.maxComplexity
+			resp := schema.Execute(context.Background(), Request{Query: tt.query})
+			if !resp.RequestError() || !strings.Contains(resp.Errors[0].Message, "complexity of") {
+				t.Errorf("Execute() over the limit errors = %s, want a complexity error", marshal(t, resp.Errors))
+			}
+		})
+	}
+}
+
+func TestExecuteUnboundedListSize(t *testing.T) {
+	var batches []int
+	schema := testSchema(&batches)
+	schema.MaxListSize = 0
+	schema.MaxComplexity = 0
+
+	resp := schema.Execute(context.Background(), Request{Query: `{ books(limit: 1000) { id } }`})
+	if resp.RequestError() {
+		t.Errorf("Execute() errors = %s, want no limit on the list size", marshal(t, resp.Errors))
+	}
+
+	resp = schema.Execute(context.Background(), Request{Query: `{ books(limit: 0) { id } }`})
+	if !resp.RequestError() || !strings.Contains(resp.Errors[0].Message, "must be greater than zero") {
+		t.Errorf("Execute() errors = %s, want the limit to be rejected", marshal(t, resp.Errors))
+	}
+}
@@ -0,0 +1,651 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Document is a parsed GraphQL request document
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+// Operation is a query or mutation of a document
+type Operation struct {
+	Type       string // query or mutation
+	Name       string
+	Variables  []*VariableDefinition
+	Selections []Selection
+}
+
+// VariableDefinition declares a variable of an operation
+type VariableDefinition struct {
+	Name    string
+	Type    string
+	Default interface{}
+}
+
+// Selection is one of *FieldNode, *FragmentSpread or *InlineFragment
+type Selection interface{}
+
+// FieldNode is a field asked for in a selection set
+type FieldNode struct {
+	Alias      string
+	Name       string
+	Arguments  map[string]interface{}
+	Directives []*Directive
+	Selections []Selection
+}
+
+// ResponseKey is the key of the field in the result, the alias when there is one
+func (f *FieldNode) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// FragmentSpread includes a named fragment, ...Name
+type FragmentSpread struct {
+	Name       string
+	Directives []*Directive
+}
+
+// InlineFragment is an anonymous fragment, ... on Type { }
+type InlineFragment struct {
+	TypeCondition string
+	Directives    []*Directive
+	Selections    []Selection
+}
+
+// Fragment is a named fragment definition
+type Fragment struct {
+	Name          string
+	TypeCondition string
+	Selections    []Selection
+}
+
+// Directive is a directive like @include(if: $flag)
+type Directive struct {
+	Name      string
+	Arguments map[string]interface{}
+}
+
+// Variable is a reference to an operation variable inside a value
+type Variable string
+
+// Enum is an enum literal inside a value
+type Enum string
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+// lex splits a document into tokens, commas and comments are ignored
+func lex(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.ContainsRune("!$&()[]{}:=@|", rune(c)):
+			tokens = append(tokens, token{tokenPunct, string(c), i})
+			i++
+		case c == '.':
+			if !strings.HasPrefix(src[i:], "...") {
+				return nil, fmt.Errorf("syntax error: unexpected \".\" at %d", i)
+			}
+			tokens = append(tokens, token{tokenPunct, "...", i})
+			i += 3
+		case c == '_' || isLetter(c):
+			start := i
+			for i < len(src) && (src[i] == '_' || isLetter(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokenName, src[start:i], start})
+		case c == '-' || isDigit(c):
+			start := i
+			kind := tokenInt
+			i++
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+			if i < len(src) && src[i] == '.' {
+				kind = tokenFloat
+				i++
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				kind = tokenFloat
+				i++
+				if i < len(src) && (src[i] == '+' || src[i] == '-') {
+					i++
+				}
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, token{kind, src[start:i], start})
+		case c == '"':
+			value, n, err := lexString(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("syntax error: %v at %d", err, i)
+			}
+			tokens = append(tokens, token{tokenString, value, i})
+			i += n
+		default:
+			r, _ := utf8.DecodeRuneInString(src[i:])
+			return nil, fmt.Errorf("syntax error: unexpected character %q at %d", r, i)
+		}
+	}
+	tokens = append(tokens, token{tokenEOF, "", len(src)})
+	return tokens, nil
+}
+
+// lexString reads a quoted or block string and returns its value and its length in the source
+func lexString(src string) (string, int, error) {
+	if strings.HasPrefix(src, `"""`) {
+		end := strings.Index(src[3:], `"""`)
+		if end < 0 {
+			return "", 0, fmt.Errorf("unterminated block string")
+		}
+		return strings.TrimSpace(src[3 : 3+end]), end + 6, nil
+	}
+
+	for i := 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '\n':
+			return "", 0, fmt.Errorf("unterminated string")
+		case '"':
+			value, err := strconv.Unquote(src[:i+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid string")
+			}
+			return value, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+func isLetter(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Parse parses a GraphQL document
+func Parse(src string) (*Document, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	doc := &Document{Fragments: make(map[string]*Fragment)}
+
+	for p.peek().kind != tokenEOF {
+		switch {
+		case p.peekPunct("{"):
+			selections, err := p.parseSelectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, &Operation{Type: "query", Selections: selections})
+		case p.peekName("query"), p.peekName("mutation"), p.peekName("subscription"):
+			op, err := p.parseOperation()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, op)
+		case p.peekName("fragment"):
+			fragment, err := p.parseFragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := doc.Fragments[fragment.Name]; exists {
+				return nil, fmt.Errorf("fragment %q is defined more than once", fragment.Name)
+			}
+			doc.Fragments[fragment.Name] = fragment
+		default:
+			return nil, p.unexpected()
+		}
+	}
+
+	if len(doc.Operations) == 0 {
+		return nil, fmt.Errorf("document does not contain any operation")
+	}
+
+	return doc, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) peekPunct(value string) bool {
+	t := p.peek()
+	return t.kind == tokenPunct && t.value == value
+}
+
+func (p *parser) peekName(value string) bool {
+	t := p.peek()
+	return t.kind == tokenName && t.value == value
+}
+
+func (p *parser) unexpected() error {
+	t := p.peek()
+	if t.kind == tokenEOF {
+		return fmt.Errorf("syntax error: unexpected end of document")
+	}
+	return fmt.Errorf("syntax error: unexpected %q at %d", t.value, t.pos)
+}
+
+func (p *parser) expectPunct(value string) error {
+	if !p.peekPunct(value) {
+		return p.unexpected()
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) expectName() (string, error) {
+	if p.peek().kind != tokenName {
+		return "", p.unexpected()
+	}
+	return p.next().value, nil
+}
+
+func (p *parser) parseOperation() (*Operation, error) {
+	op := &Operation{Type: p.next().value}
+
+	if p.peek().kind == tokenName {
+		op.Name = p.next().value
+	}
+
+	if p.peekPunct("(") {
+		p.next()
+		for !p.peekPunct(")") {
+			def, err := p.parseVariableDefinition()
+			if err != nil {
+				return nil, err
+			}
+			op.Variables = append(op.Variables, def)
+		}
+		p.next()
+	}
+
+	// directives on operations are parsed and ignored
+	_, err := p.parseDirectives()
+	if err != nil {
+		return nil, err
+	}
+
+	op.Selections, err = p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+
+	return op, nil
+}
+
+func (p *parser) parseVariableDefinition() (*VariableDefinition, error) {
+	err := p.expectPunct("$")
+	if err != nil {
+		return nil, err
+	}
+
+	def := &VariableDefinition{}
+	def.Name, err = p.expectName()
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.expectPunct(":")
+	if err != nil {
+		return nil, err
+	}
+
+	def.Type, err = p.parseTypeRef()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peekPunct("=") {
+		p.next()
+		def.Default, err = p.parseValue(true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return def, nil
+}
+
+// parseTypeRef reads a type reference like [Int!]! and returns it as written
+func (p *parser) parseTypeRef() (string, error) {
+	var ref string
+	if p.peekPunct("[") {
+		p.next()
+		inner, err := p.parseTypeRef()
+		if err != nil {
+			return "", err
+		}
+		err = p.expectPunct("]")
+		if err != nil {
+			return "", err
+		}
+		ref = "[" + inner + "]"
+	} else {
+		name, err := p.expectName()
+		if err != nil {
+			return "", err
+		}
+		ref = name
+	}
+
+	if p.peekPunct("!") {
+		p.next()
+		ref += "!"
+	}
+
+	return ref, nil
+}
+
+func (p *parser) parseFragment() (*Fragment, error) {
+	p.next()
+
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.peekName("on") {
+		return nil, p.unexpected()
+	}
+	p.next()
+
+	typeCondition, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.parseDirectives()
+	if err != nil {
+		return nil, err
+	}
+
+	selections, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Fragment{Name: name, TypeCondition: typeCondition, Selections: selections}, nil
+}
+
+func (p *parser) parseSelectionSet() ([]Selection, error) {
+	err := p.expectPunct("{")
+	if err != nil {
+		return nil, err
+	}
+
+	var selections []Selection
+	for !p.peekPunct("}") {
+		if p.peek().kind == tokenEOF {
+			return nil, p.unexpected()
+		}
+
+		var selection Selection
+		if p.peekPunct("...") {
+			selection, err = p.parseFragmentSelection()
+		} else {
+			selection, err = p.parseField()
+		}
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+	p.next()
+
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("syntax error: empty selection set")
+	}
+
+	return selections, nil
+}
+
+func (p *parser) parseFragmentSelection() (Selection, error) {
+	p.next()
+
+	if p.peek().kind == tokenName && !p.peekName("on") {
+		spread := &FragmentSpread{Name: p.next().value}
+		var err error
+		spread.Directives, err = p.parseDirectives()
+		if err != nil {
+			return nil, err
+		}
+		return spread, nil
+	}
+
+	inline := &InlineFragment{}
+	if p.peekName("on") {
+		p.next()
+		var err error
+		inline.TypeCondition, err = p.expectName()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	inline.Directives, err = p.parseDirectives()
+	if err != nil {
+		return nil, err
+	}
+
+	inline.Selections, err = p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+
+	return inline, nil
+}
+
+func (p *parser) parseField() (*FieldNode, error) {
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+
+	field := &FieldNode{Name: name}
+	if p.peekPunct(":") {
+		p.next()
+		field.Alias = name
+		field.Name, err = p.expectName()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	field.Arguments, err = p.parseArguments()
+	if err != nil {
+		return nil, err
+	}
+
+	field.Directives, err = p.parseDirectives()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peekPunct("{") {
+		field.Selections, err = p.parseSelectionSet()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return field, nil
+}
+
+func (p *parser) parseArguments() (map[string]interface{}, error) {
+	args := make(map[string]interface{})
+	if !p.peekPunct("(") {
+		return args, nil
+	}
+	p.next()
+
+	for !p.peekPunct(")") {
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		err = p.expectPunct(":")
+		if err != nil {
+			return nil, err
+		}
+		value, err := p.parseValue(false)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := args[name]; exists {
+			return nil, fmt.Errorf("argument %q is given more than once", name)
+		}
+		args[name] = value
+	}
+	p.next()
+
+	return args, nil
+}
+
+func (p *parser) parseDirectives() ([]*Directive, error) {
+	var directives []*Directive
+	for p.peekPunct("@") {
+		p.next()
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		args, err := p.parseArguments()
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, &Directive{Name: name, Arguments: args})
+	}
+	return directives, nil
+}
+
+// parseValue reads a value literal, variables are not allowed in constant values like defaults
+func (p *parser) parseValue(constant bool) (interface{}, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenInt:
+		p.next()
+		i, err := strconv.Atoi(t.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int %q", t.value)
+		}
+		return i, nil
+	case tokenFloat:
+		p.next()
+		f, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float %q", t.value)
+		}
+		return f, nil
+	case tokenString:
+		p.next()
+		return t.value, nil
+	case tokenName:
+		p.next()
+		switch t.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return Enum(t.value), nil
+	case tokenPunct:
+		switch t.value {
+		case "$":
+			if constant {
+				return nil, p.unexpected()
+			}
+			p.next()
+			name, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			return Variable(name), nil
+		case "[":
+			p.next()
+			list := []interface{}{}
+			for !p.peekPunct("]") {
+				value, err := p.parseValue(constant)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, value)
+			}
+			p.next()
+			return list, nil
+		case "{":
+			p.next()
+			object := map[string]interface{}{}
+			for !p.peekPunct("}") {
+				name, err := p.expectName()
+				if err != nil {
+					return nil, err
+				}
+				err = p.expectPunct(":")
+				if err != nil {
+					return nil, err
+				}
+				object[name], err = p.parseValue(constant)
+				if err != nil {
+					return nil, err
+				}
+			}
+			p.next()
+			return object, nil
+		}
+	}
+	return nil, p.unexpected()
+}
@@ -0,0 +1,157 @@
+package graphql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(`
+	# the list of the home page
+	query Home($genre: ID!, $limit: Int = 10, $ids: [ID!]) {
+		first: movies(genreId: $genre, limit: $limit) {
+			id
+			...MovieFields @include(if: true)
+			... on Movie { year }
+		}
+		movie(id: "4", tags: [1, 2.5, "three", RED, null, false]) { title }
+	}
+
+	fragment MovieFields on Movie {
+		title
+		description: summary
+	}`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if len(doc.Operations) != 1 {
+		t.Fatalf("got %d operations, want 1", len(doc.Operations))
+	}
+	op := doc.Operations[0]
+	if op.Type != "query" || op.Name != "Home" {
+		t.Errorf("got operation %s %s, want query Home", op.Type, op.Name)
+	}
+
+	wantVars := []*VariableDefinition{
+		{Name: "genre", Type: "ID!"},
+		{Name: "limit", Type: "Int", Default: 10},
+		{Name: "ids", Type: "[ID!]"},
+	}
+	if !reflect.DeepEqual(op.Variables, wantVars) {
+		t.Errorf("got variables %+v, want %+v", op.Variables, wantVars)
+	}
+
+	if len(op.Selections) != 2 {
+		t.Fatalf("got %d selections, want 2", len(op.Selections))
+	}
+
+	movies := op.Selections[0].(*FieldNode)
+	if movies.Name != "movies" || movies.Alias != "first" || movies.ResponseKey() != "first" {
+		t.Errorf("got field %s aliased %q, want movies aliased first", movies.Name, movies.Alias)
+	}
+	wantArgs := map[string]interface{}{"genreId": Variable("genre"), "limit": Variable("limit")}
+	if !reflect.DeepEqual(movies.Arguments, wantArgs) {
+		t.Errorf("got arguments %v, want %v", movies.Arguments, wantArgs)
+	}
+	if len(movies.Selections) != 3 {
+		t.Fatalf("got %d selections in movies, want 3", len(movies.Selections))
+	}
+
+	spread, ok := movies.Selections[1].(*FragmentSpread)
+	if !ok || spread.Name != "MovieFields" {
+		t.Fatalf("got %#v, want a spread of MovieFields", movies.Selections[1])
+	}
+	if len(spread.Directives) != 1 || spread.Directives[0].Name != "include" || spread.Directives[0].Arguments["if"] != true {
+		t.Errorf("got directives %+v, want @include(if: true)", spread.Directives)
+	}
+
+	inline, ok := movies.Selections[2].(*InlineFragment)
+	if !ok || inline.TypeCondition != "Movie" || len(inline.Selections) != 1 {
+		t.Errorf("got %#v, want an inline fragment on Movie", movies.Selections[2])
+	}
+
+	movie := op.Selections[1].(*FieldNode)
+	wantTags := []interface{}{1, 2.5, "three", Enum("RED"), nil, false}
+	if movie.Arguments["id"] != "4" || !reflect.DeepEqual(movie.Arguments["tags"], wantTags) {
+		t.Errorf("got arguments %v, want id 4 and tags %v", movie.Arguments, wantTags)
+	}
+
+	fragment := doc.Fragments["MovieFields"]
+	if fragment == nil || fragment.TypeCondition != "Movie" || len(fragment.Selections) != 2 {
+		t.Fatalf("got fragment %+v, want MovieFields on Movie with 2 fields", fragment)
+	}
+	if field := fragment.Selections[1].(*FieldNode); field.Alias != "description" || field.Name != "summary" {
+		t.Errorf("got field %s aliased %q, want summary aliased description", field.Name, field.Alias)
+	}
+}
+
+func TestParseShorthand(t *testing.T) {
+	doc, err := Parse(`{ a, b }`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	op := doc.Operations[0]
+	if op.Type != "query" || op.Name != "" || len(op.Selections) != 2 {
+		t.Errorf("got %+v, want an anonymous query with 2 fields", op)
+	}
+}
+
+func TestParseStrings(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`{ f(s: "plain") }`, "plain"},
+		{`{ f(s: "esc\"aped\n") }`, "esc\"aped\n"},
+		{`{ f(s: "été") }`, "été"},
+		{`{ f(s: """  block "quoted"  """) }`, `block "quoted"`},
+	}
+
+	for _, tt := range tests {
+		doc, err := Parse(tt.src)
+		if err != nil {
+			t.Errorf("Parse(%s) error = %v", tt.src, err)
+			continue
+		}
+		got := doc.Operations[0].Selections[0].(*FieldNode).Arguments["s"]
+		if got != tt.want {
+			t.Errorf("Parse(%s) got %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"empty document", ``, "does not contain any operation"},
+		{"only fragments", `fragment F on Movie { id }`, "does not contain any operation"},
+		{"unclosed selection", `{ movie { id }`, "unexpected end of document"},
+		{"empty selection", `{ }`, "empty selection set"},
+		{"unexpected character", `{ movie ^ }`, "unexpected character"},
+		{"single dot", `{ .id }`, `unexpected "."`},
+		{"unterminated string", `{ f(s: "abc) }`, "unterminated string"},
+		{"unterminated block string", `{ f(s: """abc) }`, "unterminated block string"},
+		{"duplicate argument", `{ f(a: 1, a: 2) }`, "given more than once"},
+		{"duplicate fragment", `{ id } fragment F on M { id } fragment F on M { id }`, "defined more than once"},
+		{"variable in default", `query ($a: Int = $b) { id }`, `unexpected "$"`},
+		{"fragment without type", `{ id } fragment F { id }`, `unexpected "{"`},
+		{"missing argument value", `{ f(a:) }`, `unexpected ")"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.src)
+			if err == nil {
+				t.Fatalf("Parse(%s) returned no error, want one containing %q", tt.src, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse(%s) error = %q, want it to contain %q", tt.src, err, tt.want)
+			}
+		})
+	}
+}
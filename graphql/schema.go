@@ -0,0 +1,215 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Type is the type of a field, either a *Scalar, an *Object or a *List
+type Type interface {
+	String() string
+}
+
+// Scalar is a leaf type of the schema
+type Scalar struct {
+	Name string
+	// Coerce converts an argument or variable value into the go value handed to resolvers
+	Coerce func(value interface{}) (interface{}, error)
+	// Serialize converts a resolved go value into the value written in the response
+	Serialize func(value interface{}) (interface{}, error)
+}
+
+func (s *Scalar) String() string { return s.Name }
+
+// List is a list of another type
+type List struct {
+	Of Type
+}
+
+func (l *List) String() string { return "[" + l.Of.String() + "]" }
+
+// ListOf returns the list type of t
+func ListOf(t Type) *List {
+	return &List{Of: t}
+}
+
+// Object is an object type with a set of fields
+type Object struct {
+	Name   string
+	Fields map[string]*Field
+}
+
+func (o *Object) String() string { return o.Name }
+
+// Argument is an argument accepted by a field
+type Argument struct {
+	Type     Type
+	Default  interface{}
+	Required bool
+}
+
+// ResolveFn resolves a field of a single parent value
+type ResolveFn func(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error)
+
+// BatchResolveFn resolves a field for every parent value of a selection at once and
+// returns one value per parent, in the same order. This is what lets a resolver load
+// a relation of many movies with a single query instead of one query per movie.
+type BatchResolveFn func(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error)
+
+// ComplexityFn computes the complexity of a field from its arguments and the complexity of its selection set
+type ComplexityFn func(args map[string]interface{}, childComplexity int) int
+
+// Field is a field of an object type, Batch takes precedence over Resolve
+type Field struct {
+	Type       Type
+	Args       map[string]*Argument
+	Resolve    ResolveFn
+	Batch      BatchResolveFn
+	Complexity ComplexityFn
+}
+
+// Schema is an executable schema, only queries are supported
+type Schema struct {
+	Query *Object
+	// MaxDepth is the deepest level of nested fields a query may select, 0 means no limit
+	MaxDepth int
+	// MaxComplexity is the highest complexity a query may have, 0 means no limit
+	MaxComplexity int
+	// DefaultListSize is the number of items a list field is expected to return
+	// when computing the complexity of a query, unless the field takes a limit argument
+	DefaultListSize int
+	// MaxListSize is the highest limit argument a field accepts, queries asking for more are rejected
+	// before running. 0 means no upper bound, a limit below 1 is always rejected.
+	MaxListSize int
+}
+
+// Int is a signed whole number
+var Int = &Scalar{
+	Name: "Int",
+	Coerce: func(value interface{}) (interface{}, error) {
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) <= math.MaxInt32 {
+				return int(v), nil
+			}
+		case json.Number:
+			i, err := strconv.Atoi(string(v))
+			if err == nil {
+				return i, nil
+			}
+		}
+		return nil, fmt.Errorf("Int cannot represent %v", value)
+	},
+	Serialize: func(value interface{}) (interface{}, error) {
+		v := reflect.ValueOf(value)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return v.Int(), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return v.Uint(), nil
+		}
+		return nil, fmt.Errorf("Int cannot represent %v", value)
+	},
+}
+
+// Float is a signed double precision number
+var Float = &Scalar{
+	Name: "Float",
+	Coerce: func(value interface{}) (interface{}, error) {
+		switch v := value.(type) {
+		case int:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case json.Number:
+			f, err := v.Float64()
+			if err == nil {
+				return f, nil
+			}
+		}
+		return nil, fmt.Errorf("Float cannot represent %v", value)
+	},
+	Serialize: func(value interface{}) (interface{}, error) {
+		v := reflect.ValueOf(value)
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return v.Float(), nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return float64(v.Int()), nil
+		}
+		return nil, fmt.Errorf("Float cannot represent %v", value)
+	},
+}
+
+// String is a UTF-8 character sequence, times are written as RFC 3339
+var String = &Scalar{
+	Name: "String",
+	Coerce: func(value interface{}) (interface{}, error) {
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("String cannot represent %v", value)
+	},
+	Serialize: func(value interface{}) (interface{}, error) {
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case time.Time:
+			return v.Format(time.RFC3339), nil
+		case fmt.Stringer:
+			return v.String(), nil
+		}
+		return nil, fmt.Errorf("String cannot represent %v", value)
+	},
+}
+
+// Boolean is true or false
+var Boolean = &Scalar{
+	Name: "Boolean",
+	Coerce: func(value interface{}) (interface{}, error) {
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("Boolean cannot represent %v", value)
+	},
+	Serialize: func(value interface{}) (interface{}, error) {
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("Boolean cannot represent %v", value)
+	},
+}
+
+// ID is a unique identifier, written as a string and handed to resolvers as an int
+var ID = &Scalar{
+	Name: "ID",
+	Coerce: func(value interface{}) (interface{}, error) {
+		switch v := value.(type) {
+		case string:
+			id, err := strconv.Atoi(v)
+			if err == nil {
+				return id, nil
+			}
+		default:
+			return Int.Coerce(value)
+		}
+		return nil, fmt.Errorf("ID cannot represent %v", value)
+	},
+	Serialize: func(value interface{}) (interface{}, error) {
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+		i, err := Int.Serialize(value)
+		if err != nil {
+			return nil, fmt.Errorf("ID cannot represent %v", value)
+		}
+		return fmt.Sprint(i), nil
+	},
+}
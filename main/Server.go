@@ -13,7 +13,9 @@ import (
 	"github.com/cloudinary/cloudinary-go/v2"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/cache"
 	"github.com/priyanshu-gupta07/MovieFlix-backend/models"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/moderation"
 )
 
 const version = "1.0.0"
@@ -28,18 +30,30 @@ type config struct {
 	jwt struct {
 		secret string
 	}
+	charts struct {
+		minVotes int
+	}
+	cache struct {
+		size int
+	}
+	api struct {
+		validateRequests bool
+	}
+	moderation moderation.Config
 }
 
 type AppStatus struct {
-	Status      string `json:"status"`
-	Environment string `json:"environment"`
-	Version     string `json:"version"`
+	Status      string       `json:"status"`
+	Environment string       `json:"environment"`
+	Version     string       `json:"version"`
+	Cache       *cache.Stats `json:"cache,omitempty"`
 }
 
 type application struct {
-	config config
-	logger *log.Logger
-	models models.Model
+	config     config
+	logger     *log.Logger
+	models     models.Model
+	moderation *moderation.Filter // nil publishes every text
 }
 
 func main() {
@@ -65,6 +79,82 @@ func main() {
 		jwtSecret = "jwt-secret"
 	}
 
+	// minimum number of votes a movie needs to enter the top rated chart
+	minVotes := 5
+	if v := os.Getenv("TOP_MIN_VOTES"); v != "" {
+		minVotes, err = strconv.Atoi(v)
+		if err != nil || minVotes < 1 {
+			log.Fatal("TOP_MIN_VOTES should be a positive number")
+		}
+	}
+
+	// number of entries kept in the in-memory cache, 0 disables it
+	cacheSize := 1000
+	if v := os.Getenv("CACHE_SIZE"); v != "" {
+		cacheSize, err = strconv.Atoi(v)
+		if err != nil || cacheSize < 0 {
+			log.Fatal("CACHE_SIZE should be a positive number")
+		}
+	}
+
+	// validate the requests against the OpenAPI document before they reach the handlers
+	validateRequests := false
+	if v := os.Getenv("VALIDATE_REQUESTS"); v != "" {
+		validateRequests, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatal("VALIDATE_REQUESTS should be true or false")
+		}
+	}
+
+	// moderation of the comments and reviews, the word lists are files with one word or phrase per line
+	var moderationConfig moderation.Config
+	if path := os.Getenv("MODERATION_BLOCKED_WORDS"); path != "" {
+		moderationConfig.BlockedWords, err = moderation.LoadWordList(path)
+		if err != nil {
+			log.Fatalf("failed to load MODERATION_BLOCKED_WORDS, %v", err)
+		}
+	}
+	if path := os.Getenv("MODERATION_FLAGGED_WORDS"); path != "" {
+		moderationConfig.FlaggedWords, err = moderation.LoadWordList(path)
+		if err != nil {
+			log.Fatalf("failed to load MODERATION_FLAGGED_WORDS, %v", err)
+		}
+	}
+
+	// texts with more links are held for review
+	moderationConfig.MaxLinks = 2
+	if v := os.Getenv("MODERATION_MAX_LINKS"); v != "" {
+		moderationConfig.MaxLinks, err = strconv.Atoi(v)
+		if err != nil || moderationConfig.MaxLinks < 0 {
+			log.Fatal("MODERATION_MAX_LINKS should be a positive number")
+		}
+	}
+
+	// texts repeating a character more times in a row are rejected
+	moderationConfig.MaxRepeatedChars = 10
+	if v := os.Getenv("MODERATION_MAX_REPEATED_CHARS"); v != "" {
+		moderationConfig.MaxRepeatedChars, err = strconv.Atoi(v)
+		if err != nil || moderationConfig.MaxRepeatedChars < 0 {
+			log.Fatal("MODERATION_MAX_REPEATED_CHARS should be a positive number")
+		}
+	}
+
+	// number of comments and reviews a user can post per MODERATION_WINDOW
+	moderationConfig.MaxPosts = 5
+	if v := os.Getenv("MODERATION_MAX_POSTS"); v != "" {
+		moderationConfig.MaxPosts, err = strconv.Atoi(v)
+		if err != nil || moderationConfig.MaxPosts < 0 {
+			log.Fatal("MODERATION_MAX_POSTS should be a positive number")
+		}
+	}
+	moderationConfig.Window = time.Minute
+	if v := os.Getenv("MODERATION_WINDOW"); v != "" {
+		moderationConfig.Window, err = time.ParseDuration(v)
+		if err != nil || moderationConfig.Window <= 0 {
+			log.Fatal("MODERATION_WINDOW should be a duration like 1m")
+		}
+	}
+
 	// initialize config
 	portNum, err := strconv.Atoi(port)
 	if err != nil {
@@ -74,6 +164,10 @@ func main() {
 	cfg.env = env
 	cfg.db.dsn = dsn
 	cfg.jwt.secret = jwtSecret
+	cfg.charts.minVotes = minVotes
+	cfg.cache.size = cacheSize
+	cfg.api.validateRequests = validateRequests
+	cfg.moderation = moderationConfig
 
 	// setup logger
 	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
@@ -93,10 +187,16 @@ func main() {
 		fmt.Println("Connected Successfully")
 	}
 
+	var c cache.Cache
+	if cfg.cache.size > 0 {
+		c = cache.NewLRU(cfg.cache.size)
+	}
+
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: models.CreateModel(db, cld),
+		config:     cfg,
+		logger:     logger,
+		models:     models.CreateModel(db, cld, c),
+		moderation: moderation.New(cfg.moderation),
 	}
 
 	srv := &http.Server{
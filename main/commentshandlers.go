@@ -0,0 +1,391 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/models"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/validator"
+)
+
+// maxCommentDepth is how deep replies nest, top level comments have a depth of 0
+const maxCommentDepth = 4
+
+// maxCommentsLimit is the largest page of comments a client can ask for
+const maxCommentsLimit = 100
+
+type ReactionPayload struct {
+	Reaction string `json:"reaction"`
+}
+
+// CommentPayload is a comment sent by its author, parent_id makes it a reply and is ignored on edits
+type CommentPayload struct {
+	Comment  string `json:"comment"`
+	ParentID *int   `json:"parent_id"`
+}
+
+// validateComment checks the comment payload, the text is trimmed
+func (app *application) validateComment(payload *CommentPayload) *validator.Validator {
+	v := validator.New()
+	payload.Comment = strings.TrimSpace(payload.Comment)
+	v.Required(payload.Comment, "comment", "comment is required")
+	v.IsLength(payload.Comment, "comment", 1, 2000)
+	return v
+}
+
+// get a page of the top level comments of a movie, ?cursor= is the next_cursor of the previous page
+func (app *application) getMovieComments(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	movieID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	qs := r.URL.Query()
+	v := validator.New()
+
+	page := models.CommentPage{Sort: qs.Get("sort"), Cursor: qs.Get("cursor")}
+	if page.Sort == "" {
+		page.Sort = "newest"
+	}
+	v.Check(validator.In(page.Sort, "newest", "oldest", "top"), "sort", "sort must be one of newest, oldest, top")
+
+	page.Limit = app.readInt(qs, "limit", models.DefaultCommentsLimit, v)
+	v.Check(page.Limit >= 1 && page.Limit <= maxCommentsLimit, "limit", fmt.Sprintf("limit must be between 1 and %d", maxCommentsLimit))
+
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	userID, _ := app.authenticatedUserID(r)
+	comments, err := app.models.Db.GetMovieComments(movieID, page, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.errorJSON(w, errors.New("movie not found"), http.StatusNotFound)
+		case errors.Is(err, models.ErrInvalidCursor):
+			v.AddError("cursor", "cursor is invalid or was made for another sort")
+			app.writeJSON(w, http.StatusBadRequest, v)
+		default:
+			app.logger.Println(err)
+			app.errorJSON(w, errors.New("failed to fetch the comments"), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, comments)
+}
+
+// get a page of the replies to a comment, oldest first
+func (app *application) getCommentReplies(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	qs := r.URL.Query()
+	v := validator.New()
+
+	page := app.readInt(qs, "page", 1, v)
+	v.Check(page >= 1, "page", "page must be greater than zero")
+
+	perPage := app.readInt(qs, "per_page", 20, v)
+	v.Check(perPage >= 1 && perPage <= 100, "per_page", "per_page must be between 1 and 100")
+
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	userID, _ := app.authenticatedUserID(r)
+	replies, err := app.models.Db.GetCommentReplies(id, page, perPage, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("comment not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the replies"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, replies)
+}
+
+// comment on a movie, or reply to a comment with parent_id
+func (app *application) insertComment(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	movieID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	userID, ok := app.authenticatedUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authorization header is required"), http.StatusUnauthorized)
+		return
+	}
+
+	var payload CommentPayload
+	err = app.readJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, errors.New("invalid json request"))
+		return
+	}
+
+	v := app.validateComment(&payload)
+	depth := 0
+	if payload.ParentID != nil {
+		parent, err := app.models.Db.GetComment(*payload.ParentID)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			v.AddError("parent_id", "parent comment does not exist")
+		case err != nil:
+			app.logger.Println(err)
+			app.errorJSON(w, errors.New("failed to fetch the parent comment"), http.StatusInternalServerError)
+			return
+		case parent.MovieID != movieID:
+			v.AddError("parent_id", "parent comment belongs to another movie")
+		case parent.Deleted:
+			v.AddError("parent_id", "can't reply to a deleted comment")
+		case parent.Status != models.StatusPublished:
+			v.AddError("parent_id", "can't reply to a comment waiting for moderation")
+		case parent.Depth >= maxCommentDepth:
+			v.AddError("parent_id", fmt.Sprintf("replies can't be nested more than %d levels deep", maxCommentDepth))
+		default:
+			depth = parent.Depth + 1
+		}
+	}
+	status := app.moderate(v, userID, map[string]string{"comment": payload.Comment})
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	now := time.Now()
+	comment := models.Comment{
+		MovieID:   movieID,
+		UserID:    userID,
+		ParentID:  payload.ParentID,
+		Depth:     depth,
+		Comment:   payload.Comment,
+		Status:    status,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	err = app.models.Db.InsertComment(&comment)
+	if err != nil {
+		app.moderation.Release(userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("movie not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to save the comment"), http.StatusInternalServerError)
+		return
+	}
+
+	saved, err := app.models.Db.GetComment(comment.ID)
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the comment"), http.StatusInternalServerError)
+		return
+	}
+
+	// replies held for moderation are not announced, a failed notification doesn't fail the reply
+	if comment.ParentID != nil && comment.Status == models.StatusPublished {
+		err = app.models.Db.NotifyReply(&comment)
+		if err != nil {
+			app.logger.Println(err)
+		}
+	}
+
+	app.writeJSON(w, http.StatusCreated, saved, "comment")
+}
+
+// ownComment loads a comment for its author or an admin, it answers 404 or 403 and returns nil otherwise
+func (app *application) ownComment(w http.ResponseWriter, r *http.Request) *models.Comment {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return nil
+	}
+
+	userID, ok := app.authenticatedUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authorization header is required"), http.StatusUnauthorized)
+		return nil
+	}
+
+	comment, err := app.models.Db.GetComment(id)
+	if err != nil || comment.Deleted {
+		if err == nil || errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("comment not found"), http.StatusNotFound)
+			return nil
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the comment"), http.StatusInternalServerError)
+		return nil
+	}
+
+	if comment.UserID != userID && !app.isAdmin(r) {
+		app.errorJSON(w, errors.New("only the author or an admin can change a comment"), http.StatusForbidden)
+		return nil
+	}
+
+	return comment
+}
+
+// edit the text of a comment
+func (app *application) updateComment(w http.ResponseWriter, r *http.Request) {
+	comment := app.ownComment(w, r)
+	if comment == nil {
+		return
+	}
+
+	var payload CommentPayload
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, errors.New("invalid json request"))
+		return
+	}
+
+	v := app.validateComment(&payload)
+	status := app.moderate(v, 0, map[string]string{"comment": payload.Comment})
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	comment.Comment = payload.Comment
+	// editing doesn't bring back a comment hidden by a moderator
+	if comment.Status != models.StatusHidden {
+		comment.Status = status
+	}
+	comment.UpdatedAt = time.Now()
+
+	err = app.models.Db.UpdateComment(comment)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("comment not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to update the comment"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, comment, "comment")
+}
+
+// delete a comment
+func (app *application) deleteComment(w http.ResponseWriter, r *http.Request) {
+	comment := app.ownComment(w, r)
+	if comment == nil {
+		return
+	}
+
+	err := app.models.Db.DeleteComment(comment.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("comment not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to delete the comment"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{OK: true, Message: "comment deleted successfully"})
+}
+
+// react to a comment, a new reaction replaces the previous one of the user
+func (app *application) setCommentReaction(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	userID, ok := app.authenticatedUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authorization header is required"), http.StatusUnauthorized)
+		return
+	}
+
+	var payload ReactionPayload
+	err = app.readJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, errors.New("invalid json request"))
+		return
+	}
+
+	v := validator.New()
+	v.Check(validator.In(payload.Reaction, models.CommentReactions...), "reaction", "reaction must be one of "+strings.Join(models.CommentReactions, ", "))
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	err = app.models.Db.SetCommentReaction(id, userID, payload.Reaction)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("comment not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to save the reaction"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{OK: true, Message: "reaction saved successfully"})
+}
+
+// clear the reaction of the user on a comment
+func (app *application) deleteCommentReaction(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	userID, ok := app.authenticatedUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authorization header is required"), http.StatusUnauthorized)
+		return
+	}
+
+	err = app.models.Db.DeleteCommentReaction(id, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("reaction not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to delete the reaction"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{OK: true, Message: "reaction deleted successfully"})
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// response formats supported by writeResponse
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+	formatXML  = "xml"
+)
+
+// mediaTypes maps the media types clients can ask for to the response formats
+var mediaTypes = map[string]string{
+	"application/json": formatJSON,
+	"text/csv":         formatCSV,
+	"application/xml":  formatXML,
+	"text/xml":         formatXML,
+}
+
+var errNotAcceptable = errors.New("requested format is not supported, use json, csv or xml")
+
+// writeResponse writes data in the format picked from ?format= or, when it's missing, from the Accept header.
+// JSON keeps the wrap envelope of writeJSON, CSV writes the rows only and XML uses wrap as the root element.
+// Unsupported formats are answered with 406 Not Acceptable.
+func (app *application) writeResponse(w http.ResponseWriter, r *http.Request, status int, data interface{}, wrap ...string) error {
+	w.Header().Add("Vary", "Accept")
+
+	format, err := negotiateFormat(r)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusNotAcceptable)
+		return nil
+	}
+
+	switch format {
+	case formatCSV:
+		return writeCSV(w, status, data)
+	case formatXML:
+		root := "response"
+		if len(wrap) > 0 {
+			root = wrap[0]
+		}
+		return writeXML(w, status, data, root)
+	default:
+		return app.writeJSON(w, status, data, wrap...)
+	}
+}
+
+// negotiateFormat picks the response format of a request
+func negotiateFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		switch format {
+		case formatJSON, formatCSV, formatXML:
+			return format, nil
+		}
+		return "", errNotAcceptable
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return formatJSON, nil
+	}
+
+	best, bestQ := "", 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+
+		format := ""
+		switch {
+		case mediaTypes[mediaType] != "":
+			format = mediaTypes[mediaType]
+		case mediaType == "*/*", mediaType == "application/*":
+			format = formatJSON
+		case mediaType == "text/*":
+			format = formatCSV
+		}
+		if format != "" {
+			best, bestQ = format, q
+		}
+	}
+
+	if best == "" {
+		return "", errNotAcceptable
+	}
+	return best, nil
+}
+
+// toGeneric turns data into maps, slices and scalars as they would be serialized in json
+func toGeneric(data interface{}) (interface{}, error) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	var generic interface{}
+	err = dec.Decode(&generic)
+	if err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+// sortedKeys returns the keys of an object, id first and the others alphabetically
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i] == "id" || keys[j] == "id" {
+			return keys[i] == "id"
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// writeCSV writes an object or a list of objects as csv rows, nested values are written as json
+func writeCSV(w http.ResponseWriter, status int, data interface{}) error {
+	generic, err := toGeneric(data)
+	if err != nil {
+		return err
+	}
+
+	var rows []interface{}
+	switch v := generic.(type) {
+	case []interface{}:
+		rows = v
+	case nil:
+	default:
+		rows = []interface{}{v}
+	}
+
+	// the header is the union of the keys of every row
+	columns := map[string]interface{}{}
+	for _, row := range rows {
+		if object, ok := row.(map[string]interface{}); ok {
+			for key := range object {
+				columns[key] = nil
+			}
+		} else {
+			columns["value"] = nil
+		}
+	}
+	header := sortedKeys(columns)
+
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	if len(header) > 0 {
+		cw.Write(header)
+	}
+	for _, row := range rows {
+		object, ok := row.(map[string]interface{})
+		if !ok {
+			object = map[string]interface{}{"value": row}
+		}
+		record := make([]string, len(header))
+		for i, key := range header {
+			record[i], err = csvValue(object[key])
+			if err != nil {
+				return err
+			}
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+	return nil
+}
+
+// csvValue formats one csv cell
+func csvValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		js, err := json.Marshal(v)
+		return string(js), err
+	}
+}
+
+// writeXML writes data as xml under a root element. Lists are written as repeated item elements
+// and keys that are not valid element names, like genre ids, as entry elements with a key attribute.
+func writeXML(w http.ResponseWriter, status int, data interface{}, root string) error {
+	generic, err := toGeneric(data)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	err = encodeXML(&buf, root, generic)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+	return nil
+}
+
+// encodeXML writes one element and its children
+func encodeXML(buf *bytes.Buffer, name string, value interface{}) error {
+	closing := name
+	if isXMLName(name) {
+		fmt.Fprintf(buf, "<%s>", name)
+	} else {
+		closing = "entry"
+		buf.WriteString(`<entry key="`)
+		xml.EscapeText(buf, []byte(name))
+		buf.WriteString(`">`)
+	}
+
+	switch v := value.(type) {
+	case nil:
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			err := encodeXML(buf, key, v[key])
+			if err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			err := encodeXML(buf, "item", item)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		text, err := csvValue(v)
+		if err != nil {
+			return err
+		}
+		err = xml.EscapeText(buf, []byte(text))
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(buf, "</%s>", closing)
+	return nil
+}
+
+// isXMLName reports whether name can be used as an element name as is
+func isXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+		case i > 0 && (r == '-' || r == '.' || (r >= '0' && r <= '9')):
+		default:
+			return false
+		}
+	}
+	return true
+}
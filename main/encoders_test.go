@@ -0,0 +1,244 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		accept  string
+		want    string
+		wantErr bool
+	}{
+		{"no accept header", "", "", formatJSON, false},
+		{"json", "", "application/json", formatJSON, false},
+		{"csv", "", "text/csv", formatCSV, false},
+		{"xml", "", "application/xml", formatXML, false},
+		{"text xml", "", "text/xml; charset=utf-8", formatXML, false},
+		{"any", "", "*/*", formatJSON, false},
+		{"any application", "", "application/*", formatJSON, false},
+		{"any text", "", "text/*", formatCSV, false},
+		{"highest q wins", "", "application/json;q=0.5, text/csv;q=0.9, application/xml;q=0.7", formatCSV, false},
+		{"missing q is 1", "", "text/csv;q=0.8, application/xml", formatXML, false},
+		{"first of equal q wins", "", "application/xml, text/csv", formatXML, false},
+		{"unsupported before supported", "", "text/html, application/xml;q=0.1", formatXML, false},
+		{"q of zero refuses", "", "application/json;q=0", "", true},
+		{"invalid q is skipped", "", "text/csv;q=high, application/json;q=0.2", formatJSON, false},
+		{"invalid media range is skipped", "", "/, text/csv", formatCSV, false},
+		{"unsupported", "", "text/html, image/png", "", true},
+		{"format overrides accept", "format=xml", "text/csv", formatXML, false},
+		{"format csv", "format=csv", "", formatCSV, false},
+		{"format json", "format=json", "application/xml", formatJSON, false},
+		{"unsupported format", "format=yaml", "application/json", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/movies?"+tt.query, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+
+			got, err := negotiateFormat(r)
+			if tt.wantErr {
+				if err != errNotAcceptable {
+					t.Errorf("negotiateFormat() = %q, %v, want errNotAcceptable", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("negotiateFormat() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteResponse(t *testing.T) {
+	app := &application{}
+	data := []map[string]interface{}{{"id": 1, "title": "Heat"}}
+
+	tests := []struct {
+		name        string
+		target      string
+		accept      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"json keeps the envelope", "/v1/movies", "", http.StatusOK, "application/json",
+			`{"movies":[{"id":1,"title":"Heat"}]}`},
+		{"csv writes the rows", "/v1/movies?format=csv", "", http.StatusOK, "text/csv; charset=utf-8",
+			"id,title\n1,Heat\n"},
+		{"xml uses the envelope as root", "/v1/movies", "application/xml", http.StatusOK, "application/xml; charset=utf-8",
+			`<movies><item><id>1</id><title>Heat</title></item></movies>`},
+		{"not acceptable", "/v1/movies", "text/html", http.StatusNotAcceptable, "application/json",
+			`{"error":{"message":"requested format is not supported, use json, csv or xml"}}`},
+		{"unsupported format", "/v1/movies?format=yaml", "", http.StatusNotAcceptable, "application/json",
+			"requested format is not supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			err := app.writeResponse(w, r, http.StatusOK, data, "movies")
+			if err != nil {
+				t.Fatalf("writeResponse() error = %v", err)
+			}
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept" {
+				t.Errorf("Vary = %q, want Accept", got)
+			}
+			if !strings.Contains(w.Body.String(), tt.body) {
+				t.Errorf("body = %q, want it to contain %q", w.Body.String(), tt.body)
+			}
+		})
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		data interface{}
+		want string
+	}{
+		{
+			"header is the union of the keys, id first",
+			[]interface{}{
+				map[string]interface{}{"title": "Heat", "id": 1, "year": 1995},
+				map[string]interface{}{"id": 2, "runtime": 98, "title": "Alien"},
+			},
+			"id,runtime,title,year\n1,,Heat,1995\n2,98,Alien,\n",
+		},
+		{
+			"single object",
+			map[string]interface{}{"id": 3, "favorite": true},
+			"id,favorite\n3,true\n",
+		},
+		{
+			"nested values as json",
+			[]interface{}{map[string]interface{}{"id": 1, "genres": map[string]string{"4": "Drama"}, "tags": []string{"heist"}}},
+			"id,genres,tags\n1,\"{\"\"4\"\":\"\"Drama\"\"}\",\"[\"\"heist\"\"]\"\n",
+		},
+		{
+			"scalars under value",
+			[]interface{}{1, "two", nil},
+			"value\n1\ntwo\n\n",
+		},
+		{
+			"mixed objects and scalars",
+			[]interface{}{map[string]interface{}{"id": 1}, "loose"},
+			"id,value\n1,\n,loose\n",
+		},
+		{
+			"null writes nothing",
+			nil,
+			"",
+		},
+		{
+			"empty list writes nothing",
+			[]interface{}{},
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if err := writeCSV(w, http.StatusOK, tt.data); err != nil {
+				t.Fatalf("writeCSV() error = %v", err)
+			}
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("writeCSV() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteXML(t *testing.T) {
+	tests := []struct {
+		name string
+		root string
+		data interface{}
+		want string
+	}{
+		{
+			"object",
+			"movie",
+			map[string]interface{}{"title": "Heat & Dust", "id": 1, "rating": nil},
+			"<movie><id>1</id><rating></rating><title>Heat &amp; Dust</title></movie>",
+		},
+		{
+			"list items",
+			"movies",
+			[]interface{}{map[string]interface{}{"id": 1}, map[string]interface{}{"id": 2}},
+			"<movies><item><id>1</id></item><item><id>2</id></item></movies>",
+		},
+		{
+			"keys that are not element names",
+			"genres",
+			map[string]interface{}{"4": "Drama", "12": "Sci-Fi", "xmlns": "x", "a b": "<c>"},
+			`<genres><entry key="12">Sci-Fi</entry><entry key="4">Drama</entry><entry key="a b">&lt;c&gt;</entry><entry key="xmlns">x</entry></genres>`,
+		},
+		{
+			"nested lists and booleans",
+			"response",
+			map[string]interface{}{"tags": []string{"heist", "crime"}, "ok": true},
+			"<response><ok>true</ok><tags><item>heist</item><item>crime</item></tags></response>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if err := writeXML(w, http.StatusOK, tt.data, tt.root); err != nil {
+				t.Fatalf("writeXML() error = %v", err)
+			}
+			body := w.Body.String()
+			if !strings.HasPrefix(body, `<?xml version="1.0" encoding="UTF-8"?>`) {
+				t.Errorf("writeXML() = %q, want the xml header first", body)
+			}
+			if got := strings.TrimPrefix(body, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"); got != tt.want {
+				t.Errorf("writeXML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsXMLName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"title", true},
+		{"release_date", true},
+		{"_private", true},
+		{"a-b.c1", true},
+		{"", false},
+		{"4", false},
+		{"-dash", false},
+		{"a b", false},
+		{"XMLdata", false},
+		{"été", false},
+	}
+
+	for _, tt := range tests {
+		if got := isXMLName(tt.name); got != tt.want {
+			t.Errorf("isXMLName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
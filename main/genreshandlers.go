@@ -0,0 +1,249 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/models"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/validator"
+)
+
+type GenrePayload struct {
+	GenreName string `json:"genre_name"`
+	ParentID  *int   `json:"parent_id"`
+}
+
+type MergeGenrePayload struct {
+	TargetID int `json:"target_id"`
+}
+
+// mergeGenreResponse is the answer to a genre merge
+type mergeGenreResponse struct {
+	OK          bool   `json:"ok"`
+	Message     string `json:"message"`
+	MovedMovies int    `json:"moved_movies"`
+}
+
+// get the catalog statistics of every genre
+func (app *application) getGenreStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := app.models.Db.GetGenreStats()
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the genre statistics"), http.StatusInternalServerError)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, stats, "genre_stats")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// get one genre by id
+func (app *application) getOneGenre(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	genre, err := app.models.Db.GetGenreByID(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("genre not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the genre"), http.StatusInternalServerError)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, genre, "genre")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// validateGenre checks the genre payload sent by an admin, id is 0 for a new genre
+func (app *application) validateGenre(id int, payload *GenrePayload) *validator.Validator {
+	v := validator.New()
+
+	payload.GenreName = strings.TrimSpace(payload.GenreName)
+	v.Check(payload.GenreName != "", "genre_name", "genre name is required")
+	v.IsLength(payload.GenreName, "genre_name", 2, 100)
+
+	if payload.ParentID != nil {
+		v.Check(*payload.ParentID != id, "parent_id", "a genre can't be its own parent")
+
+		_, err := app.models.Db.GetGenreByID(*payload.ParentID)
+		if err != nil {
+			v.AddError("parent_id", "parent genre does not exist")
+		}
+	}
+
+	return v
+}
+
+// create a new genre
+func (app *application) insertGenre(w http.ResponseWriter, r *http.Request) {
+	var payload GenrePayload
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, errors.New("invalid json request"))
+		return
+	}
+
+	v := app.validateGenre(0, &payload)
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	id, err := app.models.Db.InsertGenre(payload.GenreName, payload.ParentID)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateGenre) {
+			app.errorJSON(w, err, http.StatusConflict)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to save the genre"), http.StatusInternalServerError)
+		return
+	}
+
+	genre, err := app.models.Db.GetGenreByID(id)
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the genre"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, genre, "genre")
+}
+
+// rename a genre or move it under another parent
+func (app *application) updateGenre(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	var payload GenrePayload
+	err = app.readJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, errors.New("invalid json request"))
+		return
+	}
+
+	v := app.validateGenre(id, &payload)
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	_, err = app.models.Db.UpdateGenre(id, payload.GenreName, payload.ParentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.errorJSON(w, errors.New("genre not found"), http.StatusNotFound)
+		case errors.Is(err, models.ErrDuplicateGenre), errors.Is(err, models.ErrGenreCycle):
+			app.errorJSON(w, err, http.StatusConflict)
+		default:
+			app.logger.Println(err)
+			app.errorJSON(w, errors.New("failed to update the genre"), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	genre, err := app.models.Db.GetGenreByID(id)
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the genre"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, genre, "genre")
+}
+
+// delete a genre
+func (app *application) deleteGenre(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	err = app.models.Db.DeleteGenre(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("genre not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to delete the genre"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{OK: true, Message: "genre deleted successfully"})
+}
+
+// merge a genre into another one, the source genre is deleted afterwards
+func (app *application) mergeGenre(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	var payload MergeGenrePayload
+	err = app.readJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, errors.New("invalid json request"))
+		return
+	}
+
+	v := validator.New()
+	v.Check(payload.TargetID > 0, "target_id", "target genre is required")
+	v.Check(payload.TargetID != id, "target_id", "a genre can't be merged into itself")
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	moved, err := app.models.Db.MergeGenres(id, payload.TargetID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.errorJSON(w, errors.New("genre not found"), http.StatusNotFound)
+		case errors.Is(err, models.ErrGenreCycle):
+			app.errorJSON(w, errors.New("a genre can't be merged into one of its sub-genres"), http.StatusConflict)
+		default:
+			app.logger.Println(err)
+			app.errorJSON(w, errors.New("failed to merge the genres"), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var resp mergeGenreResponse
+
+	resp.OK = true
+	resp.Message = fmt.Sprintf("genre %d merged into genre %d", id, payload.TargetID)
+	resp.MovedMovies = moved
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
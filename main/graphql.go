@@ -0,0 +1,535 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/priyanshu-gupta07/MovieFlix-backend/graphql"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/models"
+)
+
+const (
+	// graphqlMaxDepth is how deeply a graphql query may nest fields
+	graphqlMaxDepth = 6
+	// graphqlMaxComplexity caps the estimated number of fields a graphql query resolves
+	graphqlMaxComplexity = 2000
+	// graphqlMaxLimit is the highest limit a list field accepts
+	graphqlMaxLimit = 100
+)
+
+// graphqlMovieFields are the movie columns loaded for graphql queries,
+// genres and tags are only loaded when the query selects them
+var graphqlMovieFields = models.FieldSet{"id": true, "title": true, "description": true}
+
+// graphqlHandler answers graphql queries sent with GET ?query= or POST {"query": ...}
+func (app *application) graphqlHandler(schema *graphql.Schema) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req graphql.Request
+
+		if r.Method == http.MethodGet {
+			qs := r.URL.Query()
+			req.Query = qs.Get("query")
+			req.OperationName = qs.Get("operationName")
+			if variables := qs.Get("variables"); variables != "" {
+				err := json.Unmarshal([]byte(variables), &req.Variables)
+				if err != nil {
+					app.badRequest(w, r, errors.New("variables must be a json object"))
+					return
+				}
+			}
+		} else {
+			err := app.readJSON(w, r, &req)
+			if err != nil {
+				app.badRequest(w, r, errors.New("invalid json request"))
+				return
+			}
+		}
+
+		if strings.TrimSpace(req.Query) == "" {
+			app.badRequest(w, r, errors.New("query is required"))
+			return
+		}
+
+		resp := schema.Execute(r.Context(), req)
+
+		status := http.StatusOK
+		if resp.RequestError() {
+			status = http.StatusBadRequest
+		}
+
+		for _, gqlErr := range resp.Errors {
+			app.logger.Println("graphql:", gqlErr.Message)
+		}
+
+		err := app.writeJSON(w, status, resp)
+		if err != nil {
+			app.logger.Println(err)
+		}
+	}
+}
+
+// gqlField is a field read from its parent value
+func gqlField(t graphql.Type, get func(parent interface{}) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: t,
+		Resolve: func(_ context.Context, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return get(parent), nil
+		},
+	}
+}
+
+// gqlLimitArg is the limit argument of list fields
+func gqlLimitArg(def int) map[string]*graphql.Argument {
+	return map[string]*graphql.Argument{"limit": {Type: graphql.Int, Default: def}}
+}
+
+// gqlLimit reads the limit argument of a list field
+func gqlLimit(args map[string]interface{}) (int, error) {
+	limit, _ := args["limit"].(int)
+	if limit < 1 || limit > graphqlMaxLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", graphqlMaxLimit)
+	}
+	return limit, nil
+}
+
+// gqlIDs converts a coerced [ID] argument into ints
+func gqlIDs(value interface{}) []int {
+	items, _ := value.([]interface{})
+	ids := make([]int, 0, len(items))
+	for _, item := range items {
+		if id, ok := item.(int); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// movieIDs returns the ids of the parent movies of a batch
+func movieIDs(parents []interface{}) []int {
+	ids := make([]int, len(parents))
+	for i, parent := range parents {
+		ids[i] = parent.(*models.Movie).ID
+	}
+	return ids
+}
+
+// loadMovies loads the movies of the given ids for graphql, keeping the order of ids
+func (app *application) loadMovies(ids []int) ([]*models.Movie, error) {
+	return app.models.Db.GetMoviesByIDs(ids, models.MovieOptions{Fields: graphqlMovieFields})
+}
+
+// batchUsers resolves the author of comments, ratings or favorites with a single query
+func (app *application) batchUsers(userID func(parent interface{}) int) graphql.BatchResolveFn {
+	return func(_ context.Context, parents []interface{}, _ map[string]interface{}) ([]interface{}, error) {
+		ids := make([]int, len(parents))
+		for i, parent := range parents {
+			ids[i] = userID(parent)
+		}
+
+		users, err := app.models.Db.GetUsersByIDs(ids)
+		if err != nil {
+			return nil, err
+		}
+
+		values := make([]interface{}, len(parents))
+		for i, id := range ids {
+			if user, ok := users[id]; ok {
+				values[i] = user
+			}
+		}
+		return values, nil
+	}
+}
+
+// graphqlSchema builds the schema of the graphql endpoint. List relations are resolved
+// for all the movies of a level at once, so a query costs one sql query per nested field.
+func (app *application) graphqlSchema() *graphql.Schema {
+	user := &graphql.Object{Name: "User"}
+	user.Fields = map[string]*graphql.Field{
+		"id":   gqlField(graphql.ID, func(p interface{}) interface{} { return p.(*models.User).ID }),
+		"name": gqlField(graphql.String, func(p interface{}) interface{} { return p.(*models.User).FullName }),
+	}
+
+	comment := &graphql.Object{Name: "Comment"}
+	comment.Fields = map[string]*graphql.Field{
+		"id":        gqlField(graphql.ID, func(p interface{}) interface{} { return p.(models.Comment).ID }),
+		"comment":   gqlField(graphql.String, func(p interface{}) interface{} { return p.(models.Comment).Comment }),
+		"createdAt": gqlField(graphql.String, func(p interface{}) interface{} { return p.(models.Comment).CreatedAt }),
+		"updatedAt": gqlField(graphql.String, func(p interface{}) interface{} { return p.(models.Comment).UpdatedAt }),
+		"user": {
+			Type:  user,
+			Batch: app.batchUsers(func(p interface{}) int { return p.(models.Comment).UserID }),
+		},
+	}
+
+	rating := &graphql.Object{Name: "Rating"}
+	rating.Fields = map[string]*graphql.Field{
+		"id":        gqlField(graphql.ID, func(p interface{}) interface{} { return p.(models.Rating).ID }),
+		"rating":    gqlField(graphql.Float, func(p interface{}) interface{} { return p.(models.Rating).Rating }),
+		"createdAt": gqlField(graphql.String, func(p interface{}) interface{} { return p.(models.Rating).CreatedAt }),
+		"updatedAt": gqlField(graphql.String, func(p interface{}) interface{} { return p.(models.Rating).UpdatedAt }),
+		"user": {
+			Type:  user,
+			Batch: app.batchUsers(func(p interface{}) int { return p.(models.Rating).UserID }),
+		},
+	}
+
+	favorite := &graphql.Object{Name: "Favorite"}
+	favorite.Fields = map[string]*graphql.Field{
+		"id":        gqlField(graphql.ID, func(p interface{}) interface{} { return p.(models.Favorite).ID }),
+		"createdAt": gqlField(graphql.String, func(p interface{}) interface{} { return p.(models.Favorite).CreatedAt }),
+		"user": {
+			Type:  user,
+			Batch: app.batchUsers(func(p interface{}) int { return p.(models.Favorite).UserID }),
+		},
+	}
+
+	tag := &graphql.Object{Name: "Tag"}
+	tag.Fields = map[string]*graphql.Field{
+		"id":   gqlField(graphql.ID, func(p interface{}) interface{} { return p.(models.Tag).ID }),
+		"name": gqlField(graphql.String, func(p interface{}) interface{} { return p.(models.Tag).Name }),
+		"slug": gqlField(graphql.String, func(p interface{}) interface{} { return p.(models.Tag).Slug }),
+	}
+
+	genre := &graphql.Object{Name: "Genre"}
+	genre.Fields = map[string]*graphql.Field{
+		"id":         gqlField(graphql.ID, func(p interface{}) interface{} { return p.(*models.Genre).ID }),
+		"name":       gqlField(graphql.String, func(p interface{}) interface{} { return p.(*models.Genre).GenreName }),
+		"parentId":   gqlField(graphql.ID, func(p interface{}) interface{} { return p.(*models.Genre).ParentID }),
+		"movieCount": gqlField(graphql.Int, func(p interface{}) interface{} { return p.(*models.Genre).MovieCount }),
+		"children": {
+			Type: graphql.ListOf(genre),
+			Batch: func(_ context.Context, parents []interface{}, _ map[string]interface{}) ([]interface{}, error) {
+				genres, err := app.models.Db.GetAllGenres()
+				if err != nil {
+					return nil, err
+				}
+
+				children := make(map[int][]*models.Genre)
+				for _, g := range genres {
+					if g.ParentID != nil {
+						children[*g.ParentID] = append(children[*g.ParentID], g)
+					}
+				}
+
+				values := make([]interface{}, len(parents))
+				for i, parent := range parents {
+					values[i] = children[parent.(*models.Genre).ID]
+					if values[i] == nil {
+						values[i] = []*models.Genre{}
+					}
+				}
+				return values, nil
+			},
+		},
+	}
+
+	movie := &graphql.Object{Name: "Movie"}
+	movie.Fields = map[string]*graphql.Field{
+		"id":             gqlField(graphql.ID, func(p interface{}) interface{} { return p.(*models.Movie).ID }),
+		"title":          gqlField(graphql.String, func(p interface{}) interface{} { return p.(*models.Movie).Title }),
+		"description":    gqlField(graphql.String, func(p interface{}) interface{} { return p.(*models.Movie).Description }),
+		"year":           gqlField(graphql.Int, func(p interface{}) interface{} { return p.(*models.Movie).Year }),
+		"releaseDate":    gqlField(graphql.String, func(p interface{}) interface{} { return p.(*models.Movie).ReleaseDate }),
+		"runtime":        gqlField(graphql.Int, func(p interface{}) interface{} { return p.(*models.Movie).Runtime }),
+		"image":          gqlField(graphql.String, func(p interface{}) interface{} { return p.(*models.Movie).Image }),
+		"rating":         gqlField(graphql.Float, func(p interface{}) interface{} { return p.(*models.Movie).Rating }),
+		"ratingCount":    gqlField(graphql.Int, func(p interface{}) interface{} { return p.(*models.Movie).RatingCount }),
+		"totalFavorites": gqlField(graphql.Int, func(p interface{}) interface{} { return p.(*models.Movie).TotalFavorites }),
+		"totalComments":  gqlField(graphql.Int, func(p interface{}) interface{} { return p.(*models.Movie).TotalComments }),
+		"genres": {
+			Type: graphql.ListOf(genre),
+			Batch: func(_ context.Context, parents []interface{}, _ map[string]interface{}) ([]interface{}, error) {
+				movies := make([]*models.Movie, len(parents))
+				for i, parent := range parents {
+					movies[i] = parent.(*models.Movie)
+				}
+
+				err := app.models.Db.LoadGenres(movies)
+				if err != nil {
+					return nil, err
+				}
+
+				genres, err := app.models.Db.GetAllGenres()
+				if err != nil {
+					return nil, err
+				}
+				byID := make(map[int]*models.Genre, len(genres))
+				for _, g := range genres {
+					byID[g.ID] = g
+				}
+
+				values := make([]interface{}, len(movies))
+				for i, m := range movies {
+					list := []*models.Genre{}
+					for id := range m.MovieGenre {
+						if g, ok := byID[id]; ok {
+							list = append(list, g)
+						}
+					}
+					sort.Slice(list, func(a, b int) bool { return list[a].GenreName < list[b].GenreName })
+					values[i] = list
+				}
+				return values, nil
+			},
+		},
+		"tags": {
+			Type: graphql.ListOf(tag),
+			Batch: func(_ context.Context, parents []interface{}, _ map[string]interface{}) ([]interface{}, error) {
+				movies := make([]*models.Movie, len(parents))
+				for i, parent := range parents {
+					movies[i] = parent.(*models.Movie)
+				}
+
+				err := app.models.Db.LoadTags(movies)
+				if err != nil {
+					return nil, err
+				}
+
+				values := make([]interface{}, len(movies))
+				for i, m := range movies {
+					values[i] = m.Tags
+				}
+				return values, nil
+			},
+		},
+		"comments": {
+			Type: graphql.ListOf(comment),
+			Args: gqlLimitArg(10),
+			Batch: func(_ context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+				limit, err := gqlLimit(args)
+				if err != nil {
+					return nil, err
+				}
+
+				ids := movieIDs(parents)
+				comments, err := app.models.Db.GetCommentsByMovieIDs(ids, limit)
+				if err != nil {
+					return nil, err
+				}
+
+				values := make([]interface{}, len(ids))
+				for i, id := range ids {
+					values[i] = append([]models.Comment{}, comments[id]...)
+				}
+				return values, nil
+			},
+		},
+		"ratings": {
+			Type: graphql.ListOf(rating),
+			Args: gqlLimitArg(10),
+			Batch: func(_ context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+				limit, err := gqlLimit(args)
+				if err != nil {
+					return nil, err
+				}
+
+				ids := movieIDs(parents)
+				ratings, err := app.models.Db.GetRatingsByMovieIDs(ids, limit)
+				if err != nil {
+					return nil, err
+				}
+
+				values := make([]interface{}, len(ids))
+				for i, id := range ids {
+					values[i] = append([]models.Rating{}, ratings[id]...)
+				}
+				return values, nil
+			},
+		},
+		"favorites": {
+			Type: graphql.ListOf(favorite),
+			Args: gqlLimitArg(10),
+			Batch: func(_ context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+				limit, err := gqlLimit(args)
+				if err != nil {
+					return nil, err
+				}
+
+				ids := movieIDs(parents)
+				favorites, err := app.models.Db.GetFavoritesByMovieIDs(ids, limit)
+				if err != nil {
+					return nil, err
+				}
+
+				values := make([]interface{}, len(ids))
+				for i, id := range ids {
+					values[i] = append([]models.Favorite{}, favorites[id]...)
+				}
+				return values, nil
+			},
+		},
+	}
+
+	// similar titles share the most genres with the movie
+	movie.Fields["similar"] = &graphql.Field{
+		Type: graphql.ListOf(movie),
+		Args: gqlLimitArg(5),
+		Batch: func(_ context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+			limit, err := gqlLimit(args)
+			if err != nil {
+				return nil, err
+			}
+
+			ids := movieIDs(parents)
+			similar, err := app.models.Db.GetSimilarMovieIDs(ids, limit)
+			if err != nil {
+				return nil, err
+			}
+
+			var similarIDs []int
+			for _, id := range ids {
+				similarIDs = append(similarIDs, similar[id]...)
+			}
+
+			movies, err := app.loadMovies(similarIDs)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[int]*models.Movie, len(movies))
+			for _, m := range movies {
+				byID[m.ID] = m
+			}
+
+			values := make([]interface{}, len(ids))
+			for i, id := range ids {
+				list := []*models.Movie{}
+				for _, similarID := range similar[id] {
+					if m, ok := byID[similarID]; ok {
+						list = append(list, m)
+					}
+				}
+				values[i] = list
+			}
+			return values, nil
+		},
+	}
+
+	query := &graphql.Object{Name: "Query"}
+	query.Fields = map[string]*graphql.Field{
+		"movie": {
+			Type: movie,
+			Args: map[string]*graphql.Argument{"id": {Type: graphql.ID, Required: true}},
+			Resolve: func(_ context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+				movies, err := app.loadMovies([]int{args["id"].(int)})
+				if err != nil || len(movies) == 0 {
+					return nil, err
+				}
+				return movies[0], nil
+			},
+		},
+		"movies": {
+			Type: graphql.ListOf(movie),
+			Args: map[string]*graphql.Argument{
+				"ids":     {Type: graphql.ListOf(graphql.ID)},
+				"genreId": {Type: graphql.ID},
+				"limit":   {Type: graphql.Int, Default: 20},
+				"offset":  {Type: graphql.Int, Default: 0},
+			},
+			Complexity: func(args map[string]interface{}, childComplexity int) int {
+				size, _ := args["limit"].(int)
+				if ids, ok := args["ids"].([]interface{}); ok {
+					size = len(ids)
+				}
+				// validate rejected the limits out of range already, this keeps the estimate sound regardless
+				if size < 1 {
+					size = 1
+				}
+				return 1 + size*childComplexity
+			},
+			Resolve: func(_ context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+				if args["ids"] != nil {
+					ids := gqlIDs(args["ids"])
+					if len(ids) > graphqlMaxLimit {
+						return nil, fmt.Errorf("at most %d ids can be given", graphqlMaxLimit)
+					}
+					return app.loadMovies(ids)
+				}
+
+				limit, err := gqlLimit(args)
+				if err != nil {
+					return nil, err
+				}
+
+				offset, _ := args["offset"].(int)
+				if offset < 0 {
+					return nil, errors.New("offset must not be negative")
+				}
+
+				genreID, _ := args["genreId"].(int)
+				ids, err := app.models.Db.GetMovieIDs(genreID, limit, offset)
+				if err != nil {
+					return nil, err
+				}
+				return app.loadMovies(ids)
+			},
+		},
+		"topMovies": {
+			Type: graphql.ListOf(movie),
+			Args: map[string]*graphql.Argument{
+				"limit":    {Type: graphql.Int, Default: 10},
+				"minVotes": {Type: graphql.Int},
+			},
+			Resolve: func(_ context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+				limit, err := gqlLimit(args)
+				if err != nil {
+					return nil, err
+				}
+
+				minVotes := app.config.charts.minVotes
+				if v, ok := args["minVotes"].(int); ok {
+					minVotes = v
+				}
+				if minVotes < 1 {
+					return nil, errors.New("minVotes must be greater than zero")
+				}
+
+				top, err := app.models.Db.GetTopMovies(minVotes, limit, models.MovieOptions{Fields: models.FieldSet{"id": true}})
+				if err != nil {
+					return nil, err
+				}
+
+				ids := make([]int, len(top))
+				for i, m := range top {
+					ids[i] = m.ID
+				}
+				return app.loadMovies(ids)
+			},
+		},
+		"genre": {
+			Type: genre,
+			Args: map[string]*graphql.Argument{"id": {Type: graphql.ID, Required: true}},
+			Resolve: func(_ context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+				genres, err := app.models.Db.GetAllGenres()
+				if err != nil {
+					return nil, err
+				}
+				for _, g := range genres {
+					if g.ID == args["id"].(int) {
+						return g, nil
+					}
+				}
+				return nil, nil
+			},
+		},
+		"genres": {
+			Type: graphql.ListOf(genre),
+			Resolve: func(_ context.Context, _ interface{}, _ map[string]interface{}) (interface{}, error) {
+				return app.models.Db.GetAllGenres()
+			},
+		},
+	}
+
+	return &graphql.Schema{
+		Query:           query,
+		MaxDepth:        graphqlMaxDepth,
+		MaxComplexity:   graphqlMaxComplexity,
+		DefaultListSize: 10,
+		MaxListSize:     graphqlMaxLimit,
+	}
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -25,6 +27,10 @@ func (app *application) GetStatus(w http.ResponseWriter, r *http.Request) {
 		Environment: app.config.env,
 		Version:     version,
 	}
+	if app.models.Db.Cache != nil {
+		stats := app.models.Db.Cache.Stats()
+		currentStatus.Cache = &stats
+	}
 	err := app.writeJSON(w, http.StatusOK, currentStatus, "app_status")
 	if err != nil {
 		app.logger.Println(err)
@@ -42,17 +48,137 @@ type MoviePayload struct {
 	MovieGenre  map[int]string `json:"genres"`
 }
 
+// maxBatchMovies is the most movies a batch fetch can ask for
+const maxBatchMovies = 100
+
+// MovieBatchPayload is the body of a batch fetch of movies
+type MovieBatchPayload struct {
+	IDs []int `json:"ids"`
+}
+
 // get all movies /req;
 func (app *application) getAllMovies(w http.ResponseWriter, r *http.Request) {
+	// ?fields=id,title only returns the given fields
+	v := validator.New()
+	fields := app.readFields(r.URL.Query(), v)
+
+	// ?ids=1,2,3 returns the given movies only
+	var ids []int
+	if r.URL.Query().Has("ids") {
+		for _, s := range app.readCSV(r.URL.Query(), "ids") {
+			id, err := strconv.Atoi(s)
+			if err != nil {
+				v.AddError("ids", "ids must be a comma separated list of integers")
+				break
+			}
+			ids = append(ids, id)
+		}
+		app.validateMovieIDs(ids, v)
+	}
+
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	if ids != nil {
+		app.writeMovieBatch(w, r, ids, fields)
+		return
+	}
+
 	//get all movies from db
-	movies, err := app.models.Db.GetAllMovies()
+	movies, err := app.models.Db.GetAllMovies(app.movieOptions(r, fields))
 	if err != nil {
 		app.logger.Println(err)
 		app.errorJSON(w, err)
 		return
 	}
 	//write movies to response
-	err = app.writeJSON(w, http.StatusOK, movies, "movies")
+	app.setMoviesLastModified(w, movies...)
+	err = app.writeMovies(w, r, http.StatusOK, movies, fields, "movies")
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// get the movies of a list of ids too long for a query string
+func (app *application) getMovieBatch(w http.ResponseWriter, r *http.Request) {
+	var payload MovieBatchPayload
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, errors.New("invalid json request"))
+		return
+	}
+
+	v := validator.New()
+	fields := app.readFields(r.URL.Query(), v)
+	app.validateMovieIDs(payload.IDs, v)
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	app.writeMovieBatch(w, r, payload.IDs, fields)
+}
+
+func (app *application) validateMovieIDs(ids []int, v *validator.Validator) {
+	v.Check(len(ids) > 0, "ids", "at least one id is required")
+	v.Check(len(ids) <= maxBatchMovies, "ids", fmt.Sprintf("at most %d ids can be requested", maxBatchMovies))
+	for _, id := range ids {
+		if id < 1 {
+			v.AddError("ids", "ids must be positive integers")
+			break
+		}
+	}
+}
+
+// writeMovieBatch writes the movies of ids in the requested order, the ids without a movie are listed in missing
+func (app *application) writeMovieBatch(w http.ResponseWriter, r *http.Request, ids []int, fields models.FieldSet) {
+	// each movie is returned once, at the position it was first requested
+	seen := make(map[int]bool, len(ids))
+	unique := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	movies, err := app.models.Db.GetMoviesByIDs(unique, app.movieOptions(r, fields))
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the movies"), http.StatusInternalServerError)
+		return
+	}
+
+	found := make(map[int]bool, len(movies))
+	for _, movie := range movies {
+		found[movie.ID] = true
+	}
+	missing := []int{}
+	for _, id := range unique {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+
+	selected, err := selectFields(movies, fields)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if len(movies) > 0 {
+		app.setMoviesLastModified(w, movies...)
+	}
+	// csv rows can't carry the envelope, they list the movies found and leave out the missing ids
+	var data interface{} = map[string]interface{}{"movies": selected, "missing": missing}
+	if format, err := negotiateFormat(r); err == nil && format == formatCSV {
+		data = selected
+	}
+	err = app.writeResponse(w, r, http.StatusOK, data)
 	if err != nil {
 		app.logger.Println(err)
 		app.errorJSON(w, err)
@@ -69,8 +195,14 @@ func (app *application) GetAllGenres(w http.ResponseWriter, r *http.Request) {
 		app.errorJSON(w, err)
 		return
 	}
-	//write genres to response
-	err = app.writeJSON(w, http.StatusOK, genres, "genres")
+	lastModified, err := app.models.Db.GenresLastModified()
+	if err != nil {
+		app.logger.Println(err)
+	}
+	setLastModified(w, lastModified)
+
+	//write genres to response as a tree of genres and sub-genres
+	err = app.writeResponse(w, r, http.StatusOK, models.BuildGenreTree(genres), "genres")
 	if err != nil {
 		app.logger.Println(err)
 		app.errorJSON(w, err)
@@ -79,15 +211,23 @@ func (app *application) GetAllGenres(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) GetLatestMovies(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	fields := app.readFields(r.URL.Query(), v)
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
 	//get latest featured movies on the platform
-	movies, err := app.models.Db.GetLatestMovies()
+	movies, err := app.models.Db.GetLatestMovies(app.movieOptions(r, fields))
 	if err != nil {
 		app.logger.Println(err)
 		app.errorJSON(w, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, movies, "movies")
+	app.setMoviesLastModified(w, movies...)
+	err = app.writeMovies(w, r, http.StatusOK, movies, fields, "movies")
 
 	if err != nil {
 		app.logger.Println(err)
@@ -96,6 +236,40 @@ func (app *application) GetLatestMovies(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// get the top rated movies ranked by weighted rating
+func (app *application) getTopMovies(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	minVotes := app.readInt(qs, "min_votes", app.config.charts.minVotes, v)
+	v.Check(minVotes >= 1, "min_votes", "min_votes must be greater than zero")
+
+	limit := app.readInt(qs, "limit", 10, v)
+	v.Check(limit >= 1 && limit <= 100, "limit", "limit must be between 1 and 100")
+
+	fields := app.readFields(qs, v)
+
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	movies, err := app.models.Db.GetTopMovies(minVotes, limit, app.movieOptions(r, fields))
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, err)
+		return
+	}
+
+	app.setMoviesLastModified(w, movies...)
+	err = app.writeMovies(w, r, http.StatusOK, movies, fields, "movies")
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, err)
+		return
+	}
+}
+
 func (app *application) getAllMoviesByGenre(w http.ResponseWriter, r *http.Request) {
 	params := httprouter.ParamsFromContext(r.Context())
 
@@ -105,7 +279,16 @@ func (app *application) getAllMoviesByGenre(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	movies, err := app.models.Db.GetMoviesByGenre(genreID)
+	// ?include_subgenres=true also returns the movies of the sub-genres
+	v := validator.New()
+	includeSubgenres := app.readBool(r.URL.Query(), "include_subgenres", false, v)
+	fields := app.readFields(r.URL.Query(), v)
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	movies, err := app.models.Db.GetMoviesByGenre(genreID, includeSubgenres, app.movieOptions(r, fields))
 	if err != nil {
 		app.errorJSON(w, err)
 		return
@@ -113,7 +296,8 @@ func (app *application) getAllMoviesByGenre(w http.ResponseWriter, r *http.Reque
 
 	app.logger.Println(genreID)
 
-	err = app.writeJSON(w, http.StatusOK, movies, "movies")
+	app.setMoviesLastModified(w, movies...)
+	err = app.writeMovies(w, r, http.StatusOK, movies, fields, "movies")
 	if err != nil {
 		app.errorJSON(w, err)
 		return
@@ -129,13 +313,60 @@ func (app *application) getOneMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	movie, err := app.models.Db.GetMovie(id)
+	// ?include=comments,ratings loads only the given relations
+	v := validator.New()
+	include := app.readMovieInclude(r.URL.Query(), v)
+	fields := app.readFields(r.URL.Query(), v)
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	// relations trimmed out of the response are not loaded at all
+	include.Genres = include.Genres && fields.Has("genres")
+	include.Tags = include.Tags && fields.Has("tags")
+	include.Comments = include.Comments && fields.Has("comments")
+	include.Ratings = include.Ratings && fields.Has("ratings")
+	include.Favorites = include.Favorites && fields.Has("favorites")
+	include.RatingSummary = include.RatingSummary && fields.Has("rating_summary")
+
+	movie, err := app.models.Db.GetMovie(id, include, app.movieOptions(r, fields))
 	if err != nil {
 		app.errorJSON(w, errors.New("failed to fetch the movie"))
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, movie, "movie")
+	app.setMoviesLastModified(w, movie)
+	err = app.writeMovies(w, r, http.StatusOK, movie, fields, "movie")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// get the rating distribution of a movie
+func (app *application) getRatingSummary(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	summary, err := app.models.Db.GetRatingSummary(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("movie not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the rating summary"), http.StatusInternalServerError)
+		return
+	}
+
+	app.setMoviesLastModified(w, &models.Movie{ID: id})
+	err = app.writeResponse(w, r, http.StatusOK, summary, "rating_summary")
 	if err != nil {
 		app.errorJSON(w, err)
 		return
@@ -148,6 +379,19 @@ type credentials struct {
 	Password string `json:"password"`
 }
 
+// loginResponse is the answer to a successful login
+type loginResponse struct {
+	OK      bool   `json:"ok"`
+	Token   string `json:"token"`
+	Message string `json:"message"`
+}
+
+// signUpResponse is the answer to a successful sign up
+type signUpResponse struct {
+	OK      bool
+	Message string
+}
+
 // custom claims
 type CustomClaims struct {
 	UserName string `json:"name"`
@@ -177,6 +421,11 @@ func (app *application) loginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if user.Suspended {
+		app.errorJSON(w, errors.New("your account is suspended"), http.StatusForbidden)
+		return
+	}
+
 	// custom claims
 	claims := CustomClaims{
 		UserType: user.UserType,
@@ -199,11 +448,7 @@ func (app *application) loginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var resp struct {
-		OK      bool   `json:"ok"`
-		Token   string `json:"token"`
-		Message string `json:"message"`
-	}
+	var resp loginResponse
 
 	resp.OK = true
 	resp.Token = signedToken
@@ -271,10 +516,7 @@ func (app *application) signUp(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// send the response
-	var resp struct {
-		OK      bool
-		Message string
-	}
+	var resp signUpResponse
 
 	// return ok response with message
 	resp.OK = true
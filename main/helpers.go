@@ -3,13 +3,37 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/models"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/moderation"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/validator"
 )
 
+// jsonResponse is the generic response sent back by the write endpoints
+type jsonResponse struct {
+	OK      bool   `json:"ok"`
+	Message string `json:"message"`
+}
+
+// jsonError is the error written by errorJSON, wrapped in an "error" key
+type jsonError struct {
+	Message string `json:"message"`
+}
+
+// badRequestError is the body written by badRequest
+type badRequestError struct {
+	Error   bool   `json:"error"`
+	Message string `json:"message"`
+}
+
 // readJSON reads json from request body into data. We only accept a single json value in the body
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, data interface{}) error {
 	maxBytes := 1048576 // max one megabyte in request body
@@ -55,15 +79,82 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data interf
 	return nil
 }
 
+// writeMovies writes a movie or a list of movies trimmed down to the fields asked for with ?fields=,
+// in the format negotiated by writeResponse
+func (app *application) writeMovies(w http.ResponseWriter, r *http.Request, status int, data interface{}, fields models.FieldSet, wrap ...string) error {
+	data, err := selectFields(data, fields)
+	if err != nil {
+		return err
+	}
+	return app.writeResponse(w, r, status, data, wrap...)
+}
+
+// movieOptions returns the options of the movie reads of a request, for the user set by optionalAuth if any
+func (app *application) movieOptions(r *http.Request, fields models.FieldSet) models.MovieOptions {
+	userID, _ := app.authenticatedUserID(r)
+	return models.MovieOptions{Fields: fields, UserID: userID}
+}
+
+// setMoviesLastModified sets the Last-Modified header from the movies and their related rows.
+// The header is best effort, a failure only leaves it out.
+func (app *application) setMoviesLastModified(w http.ResponseWriter, movies ...*models.Movie) {
+	ids := make([]int, 0, len(movies))
+	for _, movie := range movies {
+		ids = append(ids, movie.ID)
+	}
+
+	lastModified, err := app.models.Db.MoviesLastModified(ids)
+	if err != nil {
+		app.logger.Println(err)
+		return
+	}
+
+	setLastModified(w, lastModified)
+}
+
+// selectFields keeps only the given json fields of an object or of every object of a list
+func selectFields(data interface{}, fields models.FieldSet) (interface{}, error) {
+	if fields == nil {
+		return data, nil
+	}
+
+	js, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pick := func(object map[string]json.RawMessage) map[string]json.RawMessage {
+		for key := range object {
+			if !fields.Has(key) {
+				delete(object, key)
+			}
+		}
+		return object
+	}
+
+	var list []map[string]json.RawMessage
+	if err := json.Unmarshal(js, &list); err == nil {
+		for _, object := range list {
+			pick(object)
+		}
+		return list, nil
+	}
+
+	var object map[string]json.RawMessage
+	err = json.Unmarshal(js, &object)
+	if err != nil {
+		return nil, err
+	}
+
+	return pick(object), nil
+}
+
 func (app *application) errorJSON(w http.ResponseWriter, err error, status ...int) {
 	statusCode := http.StatusBadRequest
 
 	if len(status) > 0 {
 		statusCode = status[0]
 	}
-	type jsonError struct {
-		Message string `json:"message"`
-	}
 	theError := jsonError{
 		Message: err.Error(),
 	}
@@ -72,11 +163,7 @@ func (app *application) errorJSON(w http.ResponseWriter, err error, status ...in
 
 // badRequest sends a JSON response with status http.StatusBadRequest, describing the error
 func (app *application) badRequest(w http.ResponseWriter, r *http.Request, err error) error {
-	var payload struct {
-		Error   bool   `json:"error"`
-		Message string `json:"message"`
-	}
-
+	var payload badRequestError
 	payload.Error = true
 	payload.Message = err.Error()
 
@@ -115,3 +202,138 @@ func (app *application) verifyToken(tokenString string) (*CustomClaims, error) {
 	// return claims
 	return claims, nil
 }
+
+// readInt reads an integer query parameter, returning defaultValue when it is missing.
+// Values that are not integers are recorded on the validator.
+func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, fmt.Sprintf("%s must be an integer value", key))
+		return defaultValue
+	}
+
+	return i
+}
+
+// readBool reads a boolean query parameter, returning defaultValue when it is missing.
+// Values that are not booleans are recorded on the validator.
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, fmt.Sprintf("%s must be a boolean value", key))
+		return defaultValue
+	}
+
+	return b
+}
+
+// readCSV reads a comma separated query parameter, e.g. ?include=comments,ratings
+func (app *application) readCSV(qs url.Values, key string) []string {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+
+	var values []string
+	for _, value := range strings.Split(s, ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// readMovieInclude reads the relations asked with ?include= and their ?<relation>.limit= for the movie details.
+// The default relations are loaded when include is missing.
+func (app *application) readMovieInclude(qs url.Values, v *validator.Validator) models.MovieInclude {
+	include := models.DefaultMovieInclude()
+
+	if qs.Has("include") {
+		include = models.MovieInclude{}
+		for _, relation := range app.readCSV(qs, "include") {
+			switch relation {
+			case "genres":
+				include.Genres = true
+			case "tags":
+				include.Tags = true
+			case "comments":
+				include.Comments = true
+			case "ratings":
+				include.Ratings = true
+			case "favorites":
+				include.Favorites = true
+			case "rating_summary":
+				include.RatingSummary = true
+			default:
+				v.AddError("include", fmt.Sprintf("unknown relation %q", relation))
+			}
+		}
+	}
+
+	readLimit := func(key string) int {
+		limit := app.readInt(qs, key, 0, v)
+		v.Check(limit >= 0, key, fmt.Sprintf("%s must be a positive number", key))
+		return limit
+	}
+	// comments are paginated, the rest of them is read from /v1/movie/:id/comments
+	include.CommentsLimit = readLimit("comments.limit")
+	v.Check(include.CommentsLimit <= maxCommentsLimit, "comments.limit", fmt.Sprintf("comments.limit must be at most %d", maxCommentsLimit))
+	include.RatingsLimit = readLimit("ratings.limit")
+	include.FavoritesLimit = readLimit("favorites.limit")
+
+	return include
+}
+
+// readFields reads the movie fields asked for with ?fields=, the id is always returned.
+// It returns nil, meaning every field, when the parameter is missing.
+func (app *application) readFields(qs url.Values, v *validator.Validator) models.FieldSet {
+	names := app.readCSV(qs, "fields")
+	if names == nil {
+		return nil
+	}
+
+	fields := models.FieldSet{"id": true}
+	for _, name := range names {
+		if !models.IsMovieField(name) {
+			v.AddError("fields", fmt.Sprintf("unknown field %q", name))
+			continue
+		}
+		fields[name] = true
+	}
+
+	return fields
+}
+
+// moderate runs the moderation filter on the texts of a post, keyed by their field, and returns the status
+// the post is saved with. The rejections are added to v. userID is 0 for edits, they are not limited by the
+// posting velocity of the user. A new post that passes counts toward it right away, the handler gives it
+// back with app.moderation.Release when saving the post fails.
+func (app *application) moderate(v *validator.Validator, userID int, texts map[string]string) string {
+	verdict := moderation.Allow
+	for key, text := range texts {
+		if result := app.moderation.CheckText(v, key, text); result > verdict {
+			verdict = result
+		}
+	}
+
+	if userID != 0 && v.Valid() {
+		app.moderation.Reserve(v, "post", userID)
+	}
+
+	if verdict == moderation.Review {
+		return models.StatusPending
+	}
+	return models.StatusPublished
+}
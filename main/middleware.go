@@ -1,18 +1,28 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/priyanshu-gupta07/MovieFlix-backend/validator"
 )
 
 func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-None-Match, If-Modified-Since")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Last-Modified")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -22,7 +32,19 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
 type userIDKey string
+
+// userTypeKey holds the user_type claim of the token, "user" or "admin"
+type userTypeKey string
+
+// withUser adds the user of verified token claims to the request context
+func withUser(r *http.Request, userID int, claims *CustomClaims) *http.Request {
+	ctx := context.WithValue(r.Context(), userIDKey("user_id"), userID)
+	ctx = context.WithValue(ctx, userTypeKey("user_type"), claims.UserType)
+	return r.WithContext(ctx)
+}
+
 // authenticate checks whether a request is coming from an authenticated user.
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -69,8 +91,12 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), userIDKey("user_id"), userID)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			if status, err := app.checkAccount(userID); err != nil {
+				app.errorJSON(w, err, status)
+				return
+			}
+
+			next.ServeHTTP(w, withUser(r, userID, claims))
 			// next.ServeHTTP(w, r)
 		} else {
 			app.errorJSON(w, errors.New("unauthorized - user does not have permission"), http.StatusUnauthorized)
@@ -80,6 +106,70 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 	}) // end of http.HandlerFunc
 }
 
+// optionalAuth attaches the user of a valid bearer token to the request like authenticate does,
+// requests without a token, with an invalid one or from a suspended user, go through anonymously
+func (app *application) optionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		claims, err := app.verifyToken(tokenString)
+		if err != nil || (claims.UserType != "admin" && claims.UserType != "user") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userID, err := strconv.Atoi(claims.Subject)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// suspended users browse like anonymous visitors
+		if _, err := app.checkAccount(userID); err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, withUser(r, userID, claims))
+	})
+}
+
+// checkAccount returns the error and status to answer with when the user of a verified token
+// can't be let in. Tokens outlive a suspension, so the account is checked on every request.
+func (app *application) checkAccount(userID int) (int, error) {
+	suspended, err := app.models.Db.IsUserSuspended(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return http.StatusUnauthorized, errors.New("unauthorized - user does not exist")
+		}
+		app.logger.Println(err)
+		return http.StatusInternalServerError, errors.New("failed to check the account")
+	}
+	if suspended {
+		return http.StatusForbidden, errors.New("your account is suspended")
+	}
+
+	return 0, nil
+}
+
+// authenticatedUserID returns the id of the user set on the request by authenticate
+func (app *application) authenticatedUserID(r *http.Request) (int, bool) {
+	userID, ok := r.Context().Value(userIDKey("user_id")).(int)
+	return userID, ok
+}
+
+// isAdmin reports whether the user set on the request by the auth middlewares is an admin
+func (app *application) isAdmin(r *http.Request) bool {
+	userType, _ := r.Context().Value(userTypeKey("user_type")).(string)
+	return userType == "admin"
+}
+
 // auth middleware for admin
 
 // authenticate checks whether a request is coming from an authenticated user.
@@ -128,8 +218,12 @@ func (app *application) adminAuth(next http.Handler) http.Handler {
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), userIDKey("user_id"), userID)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			if status, err := app.checkAccount(userID); err != nil {
+				app.errorJSON(w, err, status)
+				return
+			}
+
+			next.ServeHTTP(w, withUser(r, userID, claims))
 			// next.ServeHTTP(w, r)
 		} else {
 			app.errorJSON(w, errors.New("unauthorized - user does not have permission"))
@@ -138,3 +232,148 @@ func (app *application) adminAuth(next http.Handler) http.Handler {
 
 	}) // end of http.HandlerFunc
 }
+
+// bufferedResponse holds a response in memory so it can be inspected before being sent
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+// conditionalGET adds a strong ETag, computed from the response body, to the successful GET responses
+// and answers 304 Not Modified when the client copy is still fresh, according to If-None-Match or,
+// when it's missing, If-Modified-Since against the Last-Modified header set by the handler.
+func (app *application) conditionalGET(cacheControl string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		res := &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+		next.ServeHTTP(res, r)
+
+		for key, values := range res.header {
+			w.Header()[key] = values
+		}
+
+		// errors are sent as they are and never cached
+		if res.status != http.StatusOK {
+			w.WriteHeader(res.status)
+			w.Write(res.body.Bytes())
+			return
+		}
+
+		etag := fmt.Sprintf(`"%x"`, sha256.Sum256(res.body.Bytes()))
+		w.Header().Set("ETag", etag)
+
+		// responses personalized for the user set by optionalAuth must not be stored by shared caches,
+		// and the user flags don't move Last-Modified so only the ETag can validate them
+		policy := cacheControl
+		if _, ok := app.authenticatedUserID(r); ok {
+			policy = strings.Replace(cacheControl, "public", "private", 1)
+			w.Header().Del("Last-Modified")
+		}
+		if w.Header().Get("Cache-Control") == "" {
+			w.Header().Set("Cache-Control", policy)
+		}
+
+		if notModified(r, etag, w.Header().Get("Last-Modified")) {
+			w.Header().Del("Content-Type")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(res.body.Bytes())
+	})
+}
+
+// notModified evaluates the conditional headers of a request, If-None-Match takes precedence over If-Modified-Since
+func notModified(r *http.Request, etag, lastModified string) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || lastModified == "" {
+		return false
+	}
+
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+
+	return !modified.After(since)
+}
+
+// setLastModified sets the Last-Modified header used by conditionalGET, a zero time is left out
+func setLastModified(w http.ResponseWriter, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	w.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+}
+
+// validateRequest rejects the requests whose parameters or json body don't match the OpenAPI document.
+// Requests to undocumented routes are left to the router.
+func (app *application) validateRequest(spec *openAPI, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, params := spec.match(r.Method, r.URL.Path)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		v := validator.New()
+		spec.validateParams(route, params, r.URL.Query(), v)
+
+		if route.Body != nil {
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1048576))
+			if err != nil {
+				app.badRequest(w, r, errors.New("invalid json request"))
+				return
+			}
+			// the handler reads the body again
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			var value interface{}
+			err = json.Unmarshal(body, &value)
+			if err != nil {
+				app.badRequest(w, r, errors.New("invalid json request"))
+				return
+			}
+			spec.schemas.validate(spec.bodies[route], value, "", v)
+		}
+
+		if !v.Valid() {
+			app.writeJSON(w, http.StatusBadRequest, v)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/models"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/validator"
+)
+
+type NotificationPayload struct {
+	Read bool `json:"read"`
+}
+
+type NotificationPreferencesPayload struct {
+	Preferences []models.NotificationPreference `json:"preferences"`
+}
+
+// markAllReadResponse is the answer to marking every notification read
+type markAllReadResponse struct {
+	OK      bool   `json:"ok"`
+	Message string `json:"message"`
+	Updated int    `json:"updated"`
+}
+
+// get a page of the notifications of the user with the unread count, ?unread=true skips the read ones
+func (app *application) getMyNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.authenticatedUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authorization header is required"), http.StatusUnauthorized)
+		return
+	}
+
+	qs := r.URL.Query()
+	v := validator.New()
+
+	unread := app.readBool(qs, "unread", false, v)
+
+	page := app.readInt(qs, "page", 1, v)
+	v.Check(page >= 1, "page", "page must be greater than zero")
+
+	perPage := app.readInt(qs, "per_page", 20, v)
+	v.Check(perPage >= 1 && perPage <= 100, "per_page", "per_page must be between 1 and 100")
+
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	inbox, err := app.models.Db.GetNotifications(userID, unread, page, perPage)
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the notifications"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, inbox)
+}
+
+// mark a notification of the user read, or unread with {"read": false}
+func (app *application) markNotification(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	userID, ok := app.authenticatedUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authorization header is required"), http.StatusUnauthorized)
+		return
+	}
+
+	var payload NotificationPayload
+	err = app.readJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, errors.New("invalid json request"))
+		return
+	}
+
+	err = app.models.Db.MarkNotificationRead(id, userID, payload.Read)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("notification not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to update the notification"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{OK: true, Message: "notification updated successfully"})
+}
+
+// mark every notification of the user read
+func (app *application) markAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.authenticatedUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authorization header is required"), http.StatusUnauthorized)
+		return
+	}
+
+	updated, err := app.models.Db.MarkAllNotificationsRead(userID)
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to update the notifications"), http.StatusInternalServerError)
+		return
+	}
+
+	var resp markAllReadResponse
+
+	resp.OK = true
+	resp.Message = fmt.Sprintf("%d notifications marked read", updated)
+	resp.Updated = updated
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// get whether the user receives each type of notification
+func (app *application) getNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.authenticatedUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authorization header is required"), http.StatusUnauthorized)
+		return
+	}
+
+	preferences, err := app.models.Db.GetNotificationPreferences(userID)
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the notification preferences"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, preferences, "preferences")
+}
+
+// opt in or out of types of notifications, the types left out keep their setting
+func (app *application) setNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.authenticatedUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authorization header is required"), http.StatusUnauthorized)
+		return
+	}
+
+	var payload NotificationPreferencesPayload
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, errors.New("invalid json request"))
+		return
+	}
+
+	v := validator.New()
+	for _, preference := range payload.Preferences {
+		v.Check(validator.In(preference.Type, models.NotificationTypes...), "preferences",
+			fmt.Sprintf("unknown notification type %q, must be one of %s", preference.Type, strings.Join(models.NotificationTypes, ", ")))
+	}
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	err = app.models.Db.SetNotificationPreferences(userID, payload.Preferences)
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to save the notification preferences"), http.StatusInternalServerError)
+		return
+	}
+
+	preferences, err := app.models.Db.GetNotificationPreferences(userID)
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the notification preferences"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, preferences, "preferences")
+}
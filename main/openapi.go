@@ -0,0 +1,869 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/graphql"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/models"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/validator"
+)
+
+// apiParam is a path or query parameter of a route
+type apiParam struct {
+	Name        string
+	In          string // path or query
+	Type        string // integer, boolean or string
+	Description string
+	Enum        []string
+	Minimum     *int
+	Maximum     *int
+	// List parameters take comma separated values, like ?include=comments,ratings
+	List bool
+}
+
+// apiRoute documents a route registered in routes(), the OpenAPI document and the
+// request validation are both built from this table
+type apiRoute struct {
+	Method  string
+	Path    string // httprouter path, e.g. /v1/movie/:id
+	Summary string
+	Tag     string
+	// Auth is "user" for routes behind authenticate, "admin" for routes behind adminAuth
+	// and "optional" for routes behind optionalAuth
+	Auth   string
+	Params []apiParam
+	// Body is a value of the type the handler reads the request body into
+	Body interface{}
+	// Status is the status of a successful response, 200 when zero
+	Status int
+	// Response is a value of the type written on success, wrapped in the Wrap key when set
+	Response interface{}
+	Wrap     string
+	// Negotiated responses can also be written as csv or xml, see writeResponse
+	Negotiated bool
+	// Conditional responses carry an ETag and answer 304, see conditionalGET
+	Conditional bool
+}
+
+func intPtr(i int) *int { return &i }
+
+var (
+	idParam          = apiParam{Name: "id", In: "path", Type: "integer", Minimum: intPtr(1)}
+	formatParam      = apiParam{Name: "format", In: "query", Type: "string", Enum: []string{"json", "csv", "xml"}, Description: "response format, overrides the Accept header"}
+	genreIDParam     = apiParam{Name: "genre_id", In: "query", Type: "integer", Minimum: intPtr(1)}
+	ratingsSortParam = apiParam{Name: "sort", In: "query", Type: "string", Enum: []string{"recent", "highest", "lowest"}}
+	spoilersParam    = apiParam{Name: "spoilers", In: "query", Type: "boolean", Description: "send the body of the spoiler reviews"}
+	fieldsParam      = apiParam{Name: "fields", In: "query", Type: "string", List: true, Description: "movie fields to return, the id is always returned"}
+)
+
+// apiRoutes lists every route of routes(). A route added there has to be documented here,
+// checkAPIRoutes fails on start when a route is registered but not documented, or the other way around.
+var apiRoutes = []apiRoute{
+	{Method: http.MethodGet, Path: "/v1/status", Summary: "Service status", Tag: "status",
+		Response: AppStatus{}, Wrap: "app_status"},
+
+	{Method: http.MethodGet, Path: "/v1/movies", Summary: "List movies, or the movies of ?ids= in the requested order", Tag: "movies", Auth: "optional",
+		Params: []apiParam{
+			{Name: "ids", In: "query", Type: "integer", List: true, Minimum: intPtr(1), Description: fmt.Sprintf("at most %d movie ids, missing ids are listed in missing", maxBatchMovies)},
+			fieldsParam, formatParam,
+		},
+		Response: movieBatchDoc{}, Negotiated: true, Conditional: true},
+	{Method: http.MethodPost, Path: "/v1/movies/batch", Summary: "Movies of a list of ids, in the requested order", Tag: "movies", Auth: "optional",
+		Params: []apiParam{fieldsParam, formatParam},
+		Body:   MovieBatchPayload{}, Response: movieBatchDoc{}, Negotiated: true},
+	{Method: http.MethodGet, Path: "/v1/movies/latest", Summary: "Latest movies", Tag: "movies", Auth: "optional",
+		Params:   []apiParam{fieldsParam, formatParam},
+		Response: []*models.Movie{}, Wrap: "movies", Negotiated: true, Conditional: true},
+	{Method: http.MethodGet, Path: "/v1/movies/top", Summary: "Top rated movies by weighted rating", Tag: "movies", Auth: "optional",
+		Params: []apiParam{
+			{Name: "min_votes", In: "query", Type: "integer", Minimum: intPtr(1), Description: "votes a movie needs to enter the chart"},
+			{Name: "limit", In: "query", Type: "integer", Minimum: intPtr(1), Maximum: intPtr(100)},
+			fieldsParam, formatParam,
+		},
+		Response: []*models.Movie{}, Wrap: "movies", Negotiated: true, Conditional: true},
+	{Method: http.MethodGet, Path: "/v1/movies/genre/:genre_id", Summary: "Movies of a genre", Tag: "movies", Auth: "optional",
+		Params: []apiParam{
+			{Name: "genre_id", In: "path", Type: "integer", Minimum: intPtr(1)},
+			{Name: "include_subgenres", In: "query", Type: "boolean", Description: "also return the movies of the sub-genres"},
+			fieldsParam, formatParam,
+		},
+		Response: []*models.Movie{}, Wrap: "movies", Negotiated: true, Conditional: true},
+	{Method: http.MethodGet, Path: "/v1/movie/:id", Summary: "Movie details", Tag: "movies", Auth: "optional",
+		Params: []apiParam{
+			idParam,
+			{Name: "include", In: "query", Type: "string", List: true, Enum: []string{"genres", "tags", "comments", "ratings", "favorites", "rating_summary"}, Description: "relations to load"},
+			{Name: "comments.limit", In: "query", Type: "integer", Minimum: intPtr(0), Maximum: intPtr(maxCommentsLimit), Description: "size of the first page of comments, 0 for the default"},
+			{Name: "ratings.limit", In: "query", Type: "integer", Minimum: intPtr(0)},
+			{Name: "favorites.limit", In: "query", Type: "integer", Minimum: intPtr(0)},
+			fieldsParam, formatParam,
+		},
+		Response: models.Movie{}, Wrap: "movie", Negotiated: true, Conditional: true},
+	{Method: http.MethodGet, Path: "/v1/movie/:id/ratings/summary", Summary: "Rating distribution of a movie", Tag: "movies",
+		Params:   []apiParam{idParam, formatParam},
+		Response: models.RatingSummary{}, Wrap: "rating_summary", Negotiated: true, Conditional: true},
+
+	{Method: http.MethodGet, Path: "/v1/genres", Summary: "Genre tree", Tag: "genres",
+		Params:   []apiParam{formatParam},
+		Response: []*models.Genre{}, Wrap: "genres", Negotiated: true, Conditional: true},
+	{Method: http.MethodGet, Path: "/v1/genres/stats", Summary: "Catalog statistics of every genre", Tag: "genres",
+		Params:   []apiParam{formatParam},
+		Response: []*models.GenreStats{}, Wrap: "genre_stats", Negotiated: true, Conditional: true},
+	{Method: http.MethodGet, Path: "/v1/genre/:id", Summary: "One genre", Tag: "genres",
+		Params:   []apiParam{idParam, formatParam},
+		Response: models.Genre{}, Wrap: "genre", Negotiated: true, Conditional: true},
+
+	{Method: http.MethodGet, Path: "/v1/movie/:id/comments", Summary: "Top level comments of a movie, paginated with a cursor", Tag: "comments", Auth: "optional",
+		Params: []apiParam{
+			idParam,
+			{Name: "sort", In: "query", Type: "string", Enum: []string{"newest", "oldest", "top"}, Description: "top puts the comments with the most reactions first"},
+			{Name: "cursor", In: "query", Type: "string", Description: "next_cursor of the previous page"},
+			{Name: "limit", In: "query", Type: "integer", Minimum: intPtr(1), Maximum: intPtr(maxCommentsLimit)},
+		},
+		Response: models.CommentList{}, Conditional: true},
+	{Method: http.MethodGet, Path: "/v1/comments/:id/replies", Summary: "Direct replies to a comment, oldest first", Tag: "comments", Auth: "optional",
+		Params: []apiParam{
+			idParam,
+			{Name: "page", In: "query", Type: "integer", Minimum: intPtr(1)},
+			{Name: "per_page", In: "query", Type: "integer", Minimum: intPtr(1), Maximum: intPtr(100)},
+		},
+		Response: models.PaginatedComments{}, Conditional: true},
+
+	{Method: http.MethodGet, Path: "/v1/movie/:id/reviews", Summary: "Reviews of a movie", Tag: "reviews", Auth: "optional",
+		Params: []apiParam{
+			idParam, spoilersParam,
+			{Name: "sort", In: "query", Type: "string", Enum: []string{"helpful", "recent"}},
+			{Name: "page", In: "query", Type: "integer", Minimum: intPtr(1)},
+			{Name: "per_page", In: "query", Type: "integer", Minimum: intPtr(1), Maximum: intPtr(100)},
+		},
+		Response: models.PaginatedReviews{}, Conditional: true},
+	{Method: http.MethodGet, Path: "/v1/reviews/:id", Summary: "One review", Tag: "reviews", Auth: "optional",
+		Params:   []apiParam{idParam, spoilersParam},
+		Response: models.Review{}, Wrap: "review", Conditional: true},
+
+	{Method: http.MethodGet, Path: "/v1/tags", Summary: "List tags", Tag: "tags",
+		Params:   []apiParam{{Name: "q", In: "query", Type: "string", Description: "search tags by name"}, formatParam},
+		Response: []*models.Tag{}, Wrap: "tags", Negotiated: true, Conditional: true},
+	{Method: http.MethodGet, Path: "/v1/tags/:slug/movies", Summary: "Movies having a tag", Tag: "tags", Auth: "optional",
+		Params:   []apiParam{{Name: "slug", In: "path", Type: "string"}, fieldsParam, formatParam},
+		Response: []*models.Movie{}, Wrap: "movies", Negotiated: true, Conditional: true},
+
+	{Method: http.MethodGet, Path: "/v1/graphql", Summary: "Run a graphql query", Tag: "graphql",
+		Params: []apiParam{
+			{Name: "query", In: "query", Type: "string"},
+			{Name: "variables", In: "query", Type: "string", Description: "json object of the query variables"},
+			{Name: "operationName", In: "query", Type: "string"},
+		},
+		Response: graphql.Response{}},
+	{Method: http.MethodPost, Path: "/v1/graphql", Summary: "Run a graphql query", Tag: "graphql",
+		Body: graphql.Request{}, Response: graphql.Response{}},
+
+	{Method: http.MethodGet, Path: "/v1/openapi.json", Summary: "This OpenAPI document", Tag: "status"},
+
+	{Method: http.MethodPut, Path: "/v1/movie/:id/rating", Summary: "Rate a movie, 201 for a new rating and 200 when it replaces the previous one", Tag: "ratings", Auth: "user",
+		Params: []apiParam{idParam}, Body: RatingPayload{}, Response: models.Rating{}, Wrap: "rating"},
+	{Method: http.MethodDelete, Path: "/v1/movie/:id/rating", Summary: "Delete the rating of the user", Tag: "ratings", Auth: "user",
+		Params: []apiParam{idParam}, Response: jsonResponse{}},
+
+	{Method: http.MethodGet, Path: "/v1/me/ratings", Summary: "Movies rated by the user with their score", Tag: "ratings", Auth: "user",
+		Params: []apiParam{
+			ratingsSortParam, genreIDParam,
+			{Name: "page", In: "query", Type: "integer", Minimum: intPtr(1)},
+			{Name: "per_page", In: "query", Type: "integer", Minimum: intPtr(1), Maximum: intPtr(100)},
+		},
+		Response: models.PaginatedMovies{}},
+	{Method: http.MethodGet, Path: "/v1/me/ratings/export", Summary: "Every rating of the user as a csv file", Tag: "ratings", Auth: "user",
+		Params: []apiParam{ratingsSortParam, genreIDParam}},
+
+	{Method: http.MethodGet, Path: "/v1/me/notifications", Summary: "Notifications of the user, most recent first, with the unread count", Tag: "notifications", Auth: "user",
+		Params: []apiParam{
+			{Name: "unread", In: "query", Type: "boolean", Description: "only return the unread notifications"},
+			{Name: "page", In: "query", Type: "integer", Minimum: intPtr(1)},
+			{Name: "per_page", In: "query", Type: "integer", Minimum: intPtr(1), Maximum: intPtr(100)},
+		},
+		Response: models.NotificationInbox{}},
+	{Method: http.MethodPatch, Path: "/v1/me/notifications/:id", Summary: "Mark a notification read or unread", Tag: "notifications", Auth: "user",
+		Params: []apiParam{idParam}, Body: NotificationPayload{}, Response: jsonResponse{}},
+	{Method: http.MethodPost, Path: "/v1/me/notifications/read-all", Summary: "Mark every notification read", Tag: "notifications", Auth: "user",
+		Response: markAllReadResponse{}},
+	{Method: http.MethodGet, Path: "/v1/me/notification-preferences", Summary: "Types of notifications the user receives", Tag: "notifications", Auth: "user",
+		Response: []models.NotificationPreference{}, Wrap: "preferences"},
+	{Method: http.MethodPut, Path: "/v1/me/notification-preferences", Summary: "Opt in or out of types of notifications", Tag: "notifications", Auth: "user",
+		Body: NotificationPreferencesPayload{}, Response: []models.NotificationPreference{}, Wrap: "preferences"},
+
+	{Method: http.MethodPost, Path: "/v1/reports", Summary: "Report a comment, a review or a user to the moderators", Tag: "reports", Auth: "user",
+		Body: ReportPayload{}, Status: http.StatusCreated, Response: models.Report{}, Wrap: "report"},
+
+	{Method: http.MethodPost, Path: "/v1/movie/:id/comments", Summary: "Comment on a movie or reply to a comment", Tag: "comments", Auth: "user",
+		Params: []apiParam{idParam}, Body: CommentPayload{}, Status: http.StatusCreated, Response: models.Comment{}, Wrap: "comment"},
+	{Method: http.MethodPatch, Path: "/v1/comments/:id", Summary: "Edit a comment, for its author or an admin", Tag: "comments", Auth: "user",
+		Params: []apiParam{idParam}, Body: CommentPayload{}, Response: models.Comment{}, Wrap: "comment"},
+	{Method: http.MethodDelete, Path: "/v1/comments/:id", Summary: "Delete a comment, for its author or an admin", Tag: "comments", Auth: "user",
+		Params: []apiParam{idParam}, Response: jsonResponse{}},
+	{Method: http.MethodPut, Path: "/v1/comments/:id/reaction", Summary: "React to a comment, replacing the previous reaction of the user", Tag: "comments", Auth: "user",
+		Params: []apiParam{idParam}, Body: ReactionPayload{}, Response: jsonResponse{}},
+	{Method: http.MethodDelete, Path: "/v1/comments/:id/reaction", Summary: "Clear the reaction of the user on a comment", Tag: "comments", Auth: "user",
+		Params: []apiParam{idParam}, Response: jsonResponse{}},
+
+	{Method: http.MethodPost, Path: "/v1/movie/:id/reviews", Summary: "Review a movie", Tag: "reviews", Auth: "user",
+		Params: []apiParam{idParam}, Body: ReviewPayload{}, Status: http.StatusCreated, Response: models.Review{}, Wrap: "review"},
+	{Method: http.MethodPut, Path: "/v1/reviews/:id", Summary: "Update a review of the user", Tag: "reviews", Auth: "user",
+		Params: []apiParam{idParam}, Body: ReviewPayload{}, Response: models.Review{}, Wrap: "review"},
+	{Method: http.MethodDelete, Path: "/v1/reviews/:id", Summary: "Delete a review of the user", Tag: "reviews", Auth: "user",
+		Params: []apiParam{idParam}, Response: jsonResponse{}},
+	{Method: http.MethodPut, Path: "/v1/reviews/:id/helpful", Summary: "Vote a review helpful", Tag: "reviews", Auth: "user",
+		Params: []apiParam{idParam}, Response: jsonResponse{}},
+	{Method: http.MethodDelete, Path: "/v1/reviews/:id/helpful", Summary: "Remove the helpful vote of the user", Tag: "reviews", Auth: "user",
+		Params: []apiParam{idParam}, Response: jsonResponse{}},
+
+	{Method: http.MethodPost, Path: "/v1/user/signup/", Summary: "Sign up", Tag: "users",
+		Body: signUpDoc{}, Response: signUpResponse{}},
+	{Method: http.MethodPost, Path: "/v1/user/login/", Summary: "Log in and get a token", Tag: "users",
+		Body: credentials{}, Response: loginResponse{}},
+
+	{Method: http.MethodPost, Path: "/v1/admin/genres", Summary: "Create a genre", Tag: "admin", Auth: "admin",
+		Body: GenrePayload{}, Status: http.StatusCreated, Response: models.Genre{}, Wrap: "genre"},
+	{Method: http.MethodPut, Path: "/v1/admin/genres/:id", Summary: "Update a genre", Tag: "admin", Auth: "admin",
+		Params: []apiParam{idParam}, Body: GenrePayload{}, Response: models.Genre{}, Wrap: "genre"},
+	{Method: http.MethodDelete, Path: "/v1/admin/genres/:id", Summary: "Delete a genre", Tag: "admin", Auth: "admin",
+		Params: []apiParam{idParam}, Response: jsonResponse{}},
+	{Method: http.MethodPost, Path: "/v1/admin/genres/:id/merge", Summary: "Merge a genre into another one", Tag: "admin", Auth: "admin",
+		Params: []apiParam{idParam}, Body: MergeGenrePayload{}, Response: mergeGenreResponse{}},
+	{Method: http.MethodPost, Path: "/v1/admin/tags", Summary: "Create a tag", Tag: "admin", Auth: "admin",
+		Body: TagPayload{}, Status: http.StatusCreated, Response: models.Tag{}, Wrap: "tag"},
+	{Method: http.MethodPut, Path: "/v1/admin/tags/:id", Summary: "Rename a tag", Tag: "admin", Auth: "admin",
+		Params: []apiParam{idParam}, Body: TagPayload{}, Response: models.Tag{}, Wrap: "tag"},
+	{Method: http.MethodDelete, Path: "/v1/admin/tags/:id", Summary: "Delete a tag", Tag: "admin", Auth: "admin",
+		Params: []apiParam{idParam}, Response: jsonResponse{}},
+	{Method: http.MethodPut, Path: "/v1/admin/movies/:id/tags", Summary: "Replace the tags of a movie", Tag: "admin", Auth: "admin",
+		Params: []apiParam{idParam}, Body: MovieTagsPayload{}, Response: jsonResponse{}},
+
+	{Method: http.MethodGet, Path: "/v1/admin/reports", Summary: "Moderation queue, oldest reports first", Tag: "admin", Auth: "admin",
+		Params: []apiParam{
+			{Name: "status", In: "query", Type: "string", Enum: append([]string{"all"}, models.ReportStatuses...), Description: "defaults to open"},
+			{Name: "target_type", In: "query", Type: "string", Enum: models.ReportTargets},
+			{Name: "page", In: "query", Type: "integer", Minimum: intPtr(1)},
+			{Name: "per_page", In: "query", Type: "integer", Minimum: intPtr(1), Maximum: intPtr(100)},
+		},
+		Response: models.PaginatedReports{}},
+	{Method: http.MethodGet, Path: "/v1/admin/reports/:id", Summary: "A report with the actions taken on it", Tag: "admin", Auth: "admin",
+		Params: []apiParam{idParam}, Response: models.Report{}, Wrap: "report"},
+	{Method: http.MethodPost, Path: "/v1/admin/reports/:id/actions", Summary: "Triage, resolve or dismiss a report, approve or hide its content or suspend the author", Tag: "admin", Auth: "admin",
+		Params: []apiParam{idParam}, Body: ModerationActionPayload{}, Response: models.Report{}, Wrap: "report"},
+	{Method: http.MethodGet, Path: "/v1/admin/pending", Summary: "Comments and reviews held by the moderation filter, oldest first", Tag: "admin", Auth: "admin",
+		Params: []apiParam{
+			{Name: "target_type", In: "query", Type: "string", Enum: models.PendingTargets},
+			{Name: "page", In: "query", Type: "integer", Minimum: intPtr(1)},
+			{Name: "per_page", In: "query", Type: "integer", Minimum: intPtr(1), Maximum: intPtr(100)},
+		},
+		Response: models.PaginatedPendingContent{}},
+	{Method: http.MethodPost, Path: "/v1/admin/pending/:type/:id", Summary: "Approve held content so it gets published, or reject it", Tag: "admin", Auth: "admin",
+		Params: []apiParam{{Name: "type", In: "path", Type: "string", Enum: models.PendingTargets}, idParam}, Body: ModerationActionPayload{}, Response: models.ModerationAction{}, Wrap: "action"},
+	{Method: http.MethodPut, Path: "/v1/admin/users/:id/suspension", Summary: "Suspend a user, suspended users can't log in", Tag: "admin", Auth: "admin",
+		Params: []apiParam{idParam}, Body: SuspensionPayload{}, Response: models.ModerationAction{}, Wrap: "action"},
+	{Method: http.MethodDelete, Path: "/v1/admin/users/:id/suspension", Summary: "Lift the suspension of a user", Tag: "admin", Auth: "admin",
+		Params: []apiParam{idParam}, Response: models.ModerationAction{}, Wrap: "action"},
+}
+
+// movieBatchDoc describes the movie listings, missing is only set when ids are requested
+type movieBatchDoc struct {
+	Movies  []*models.Movie `json:"movies"`
+	Missing []int           `json:"missing,omitempty"`
+}
+
+// signUpDoc describes the sign up body, the handler reads it into a models.User
+type signUpDoc struct {
+	FullName string `json:"full_name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// apiSchemas are payload types described in the document without a route using them yet
+var apiSchemas = []interface{}{MoviePayload{}}
+
+// routeRecorder is the router of routes(), it keeps the routes registered on it for checkAPIRoutes
+type routeRecorder struct {
+	*httprouter.Router
+	registered []string // "METHOD /path", in registration order
+}
+
+func newRouteRecorder() *routeRecorder {
+	return &routeRecorder{Router: httprouter.New()}
+}
+
+func (rr *routeRecorder) Handle(method, path string, handle httprouter.Handle) {
+	rr.registered = append(rr.registered, method+" "+path)
+	rr.Router.Handle(method, path, handle)
+}
+
+func (rr *routeRecorder) Handler(method, path string, handler http.Handler) {
+	rr.registered = append(rr.registered, method+" "+path)
+	rr.Router.Handler(method, path, handler)
+}
+
+func (rr *routeRecorder) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	rr.Handler(method, path, handler)
+}
+
+// checkAPIRoutes panics when a documented route is not registered on the router, or a registered one
+// is missing from apiRoutes
+func checkAPIRoutes(router *routeRecorder) {
+	registered := make(map[string]bool, len(router.registered))
+	for _, route := range router.registered {
+		registered[route] = true
+	}
+
+	documented := make(map[string]bool, len(apiRoutes))
+	for _, route := range apiRoutes {
+		key := route.Method + " " + route.Path
+		if !registered[key] {
+			panic(fmt.Sprintf("openapi: %s is documented but not registered", key))
+		}
+		documented[key] = true
+	}
+
+	for _, route := range router.registered {
+		if !documented[route] {
+			panic(fmt.Sprintf("openapi: %s is registered but not documented in apiRoutes", route))
+		}
+	}
+}
+
+// openAPI is the generated OpenAPI 3 document
+type openAPI struct {
+	document map[string]interface{}
+	schemas  *schemaRegistry
+	// bodies are the request body schemas of the routes, for the validation
+	bodies map[*apiRoute]map[string]interface{}
+}
+
+// newOpenAPI builds the OpenAPI document from apiRoutes and the go types they reference
+func newOpenAPI() *openAPI {
+	reg := &schemaRegistry{components: make(map[string]interface{})}
+
+	envelope := func(data interface{}, wrap string) map[string]interface{} {
+		schema := reg.schema(reflect.TypeOf(data))
+		if wrap == "" {
+			return schema
+		}
+		return map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{wrap: schema},
+		}
+	}
+
+	jsonContent := func(schema map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+	}
+
+	errorResponse := func(description string) map[string]interface{} {
+		return map[string]interface{}{
+			"description": description,
+			"content":     jsonContent(envelope(jsonError{}, "error")),
+		}
+	}
+
+	for _, payload := range apiSchemas {
+		reg.schema(reflect.TypeOf(payload))
+	}
+
+	bodies := make(map[*apiRoute]map[string]interface{})
+	paths := make(map[string]interface{})
+	for i := range apiRoutes {
+		route := &apiRoutes[i]
+		op := map[string]interface{}{
+			"summary":     route.Summary,
+			"operationId": operationID(*route),
+			"tags":        []string{route.Tag},
+		}
+
+		var params []interface{}
+		for _, p := range route.Params {
+			param := map[string]interface{}{
+				"name":     p.Name,
+				"in":       p.In,
+				"required": p.In == "path",
+				"schema":   paramSchema(p),
+			}
+			if p.Description != "" {
+				param["description"] = p.Description
+			}
+			if p.List {
+				param["style"] = "form"
+				param["explode"] = false
+			}
+			params = append(params, param)
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if route.Body != nil {
+			bodies[route] = reg.schema(reflect.TypeOf(route.Body))
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(bodies[route]),
+			}
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		success := map[string]interface{}{"description": http.StatusText(status)}
+		if route.Response != nil {
+			schema := envelope(route.Response, route.Wrap)
+			content := jsonContent(schema)
+			if route.Negotiated {
+				content["text/csv"] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+				content["application/xml"] = map[string]interface{}{"schema": schema}
+			}
+			success["content"] = content
+		}
+		if route.Conditional {
+			success["headers"] = map[string]interface{}{
+				"ETag":          map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+				"Last-Modified": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+				"Cache-Control": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+			}
+		}
+
+		responses := map[string]interface{}{
+			fmt.Sprint(status): success,
+			"400": map[string]interface{}{
+				"description": "Invalid request",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": map[string]interface{}{"oneOf": []interface{}{
+							envelope(jsonError{}, "error"),
+							reg.schema(reflect.TypeOf(badRequestError{})),
+							reg.schema(reflect.TypeOf(validator.Validator{})),
+						}},
+					},
+				},
+			},
+			"500": errorResponse("Internal server error"),
+		}
+		if route.Conditional {
+			responses["304"] = map[string]interface{}{"description": "Not modified"}
+		}
+		if route.Negotiated {
+			responses["406"] = errorResponse("None of the accepted formats can be produced")
+		}
+		if route.Auth == "user" {
+			responses["401"] = errorResponse("Missing or invalid token")
+		}
+		for _, p := range route.Params {
+			if p.In == "path" {
+				responses["404"] = errorResponse("Not found")
+				break
+			}
+		}
+		op["responses"] = responses
+
+		switch route.Auth {
+		case "user", "admin":
+			op["security"] = []interface{}{map[string]interface{}{"bearerAuth": []string{}}}
+		case "optional":
+			op["security"] = []interface{}{map[string]interface{}{}, map[string]interface{}{"bearerAuth": []string{}}}
+		}
+
+		path := openAPIPath(route.Path)
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[path] = item
+		}
+		item[strings.ToLower(route.Method)] = op
+	}
+
+	document := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "MovieFlix API",
+			"version": version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": reg.components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+
+	return &openAPI{document: document, schemas: reg, bodies: bodies}
+}
+
+// openAPIPath turns /v1/movie/:id into /v1/movie/{id}
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// operationID derives a stable operation id like getV1MovieId from the method and path
+func operationID(route apiRoute) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(route.Method))
+	for _, part := range strings.FieldsFunc(route.Path, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+func paramSchema(p apiParam) map[string]interface{} {
+	schema := map[string]interface{}{"type": p.Type}
+	if len(p.Enum) > 0 {
+		schema["enum"] = p.Enum
+	}
+	if p.Minimum != nil {
+		schema["minimum"] = *p.Minimum
+	}
+	if p.Maximum != nil {
+		schema["maximum"] = *p.Maximum
+	}
+	if p.List {
+		return map[string]interface{}{"type": "array", "items": schema}
+	}
+	return schema
+}
+
+// schemaRegistry generates json schemas from go types, named structs become components
+type schemaRegistry struct {
+	components map[string]interface{}
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+func (s *schemaRegistry) schema(t reflect.Type) map[string]interface{} {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var schema map[string]interface{}
+	switch {
+	case t == timeType:
+		schema = map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType):
+		// custom json encoding, any value
+		schema = map[string]interface{}{}
+	default:
+		switch t.Kind() {
+		case reflect.Bool:
+			schema = map[string]interface{}{"type": "boolean"}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			schema = map[string]interface{}{"type": "integer"}
+		case reflect.Float32, reflect.Float64:
+			schema = map[string]interface{}{"type": "number"}
+		case reflect.String:
+			schema = map[string]interface{}{"type": "string"}
+		case reflect.Slice, reflect.Array:
+			schema = map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+		case reflect.Map:
+			schema = map[string]interface{}{"type": "object", "additionalProperties": s.schema(t.Elem())}
+		case reflect.Struct:
+			if t.Name() == "" {
+				schema = s.object(t)
+				break
+			}
+			name := schemaName(t)
+			if _, ok := s.components[name]; !ok {
+				// registered before walking the fields so recursive types like Genre.Children resolve
+				s.components[name] = map[string]interface{}{}
+				s.components[name] = s.object(t)
+			}
+			schema = map[string]interface{}{"$ref": "#/components/schemas/" + name}
+		default:
+			schema = map[string]interface{}{}
+		}
+	}
+
+	if nullable {
+		if _, ok := schema["$ref"]; ok {
+			return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+	}
+	return schema
+}
+
+// object describes the json fields of a struct type. The fields that are neither pointers nor omitempty
+// are required, and no other field is allowed.
+func (s *schemaRegistry) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded := s.object(field.Type)
+			for key, value := range embedded["properties"].(map[string]interface{}) {
+				properties[key] = value
+			}
+			if names, ok := embedded["required"].([]string); ok {
+				required = append(required, names...)
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.schema(field.Type)
+		if field.Type.Kind() != reflect.Pointer && !strings.Contains(","+options+",", ",omitempty,") {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// schemaName is the component name of a named type, e.g. Movie or Credentials.
+// Types of the other packages are prefixed with their package, e.g. GraphqlRequest.
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	pkg := path.Base(t.PkgPath())
+	if pkg != "main" && pkg != "models" && !strings.HasPrefix(strings.ToLower(name), pkg) {
+		name = pkg + strings.ToUpper(name[:1]) + name[1:]
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// resolve follows the $ref of a schema
+func (s *schemaRegistry) resolve(schema map[string]interface{}) map[string]interface{} {
+	for {
+		ref, ok := schema["$ref"].(string)
+		if !ok {
+			return schema
+		}
+		schema = s.components[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]interface{})
+	}
+}
+
+// getOpenAPI serves the OpenAPI document
+func (app *application) getOpenAPI(spec *openAPI) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := app.writeJSON(w, http.StatusOK, spec.document)
+		if err != nil {
+			app.logger.Println(err)
+		}
+	}
+}
+
+// match finds the documented route of a request, static segments win over parameters like httprouter does
+func (spec *openAPI) match(method, path string) (*apiRoute, map[string]string) {
+	segments := strings.Split(path, "/")
+
+	var best *apiRoute
+	var bestParams map[string]string
+	bestStatic := -1
+	for i := range apiRoutes {
+		route := &apiRoutes[i]
+		pattern := strings.Split(route.Path, "/")
+		if route.Method != method || len(pattern) != len(segments) {
+			continue
+		}
+
+		params := make(map[string]string)
+		static := 0
+		matched := true
+		for j, segment := range pattern {
+			if strings.HasPrefix(segment, ":") {
+				if segments[j] == "" {
+					matched = false
+					break
+				}
+				params[segment[1:]] = segments[j]
+				continue
+			}
+			if segment != segments[j] {
+				matched = false
+				break
+			}
+			static++
+		}
+
+		if matched && static > bestStatic {
+			best, bestParams, bestStatic = route, params, static
+		}
+	}
+
+	return best, bestParams
+}
+
+// validateParams checks the path and query parameters of a request against the route
+func (spec *openAPI) validateParams(route *apiRoute, pathParams map[string]string, qs url.Values, v *validator.Validator) {
+	for _, p := range route.Params {
+		if p.In == "path" {
+			validateParam(p, pathParams[p.Name], v)
+			continue
+		}
+		if qs.Has(p.Name) {
+			validateParam(p, qs.Get(p.Name), v)
+		}
+	}
+}
+
+func validateParam(p apiParam, raw string, v *validator.Validator) {
+	values := []string{raw}
+	if p.List {
+		values = nil
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+
+	for _, value := range values {
+		switch p.Type {
+		case "integer":
+			i, err := strconv.Atoi(value)
+			if err != nil {
+				v.AddError(p.Name, fmt.Sprintf("%s must be an integer value", p.Name))
+				continue
+			}
+			if p.Minimum != nil && i < *p.Minimum {
+				v.AddError(p.Name, fmt.Sprintf("%s must be at least %d", p.Name, *p.Minimum))
+			}
+			if p.Maximum != nil && i > *p.Maximum {
+				v.AddError(p.Name, fmt.Sprintf("%s must be at most %d", p.Name, *p.Maximum))
+			}
+		case "boolean":
+			_, err := strconv.ParseBool(value)
+			if err != nil {
+				v.AddError(p.Name, fmt.Sprintf("%s must be a boolean value", p.Name))
+			}
+		}
+
+		if len(p.Enum) > 0 && !validator.In(value, p.Enum...) {
+			v.AddError(p.Name, fmt.Sprintf("%s must be one of %s", p.Name, strings.Join(p.Enum, ", ")))
+		}
+	}
+}
+
+// validate checks a decoded json value against a schema, errors are keyed by the json path of the value
+func (s *schemaRegistry) validate(schema map[string]interface{}, value interface{}, key string, v *validator.Validator) {
+	schema = s.resolve(schema)
+	name := key
+	if name == "" {
+		name = "body"
+	}
+
+	if value == nil {
+		if schema["nullable"] == true || len(schema) == 0 {
+			return
+		}
+		v.AddError(name, fmt.Sprintf("%s must not be null", name))
+		return
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			s.validate(sub.(map[string]interface{}), value, key, v)
+		}
+		return
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			v.AddError(name, fmt.Sprintf("%s must be an object", name))
+			return
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		fieldKey := func(field string) string {
+			if key == "" {
+				return field
+			}
+			return key + "." + field
+		}
+		for field, fieldValue := range object {
+			if property, ok := properties[field].(map[string]interface{}); ok {
+				s.validate(property, fieldValue, fieldKey(field), v)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case map[string]interface{}:
+				s.validate(additional, fieldValue, fieldKey(field), v)
+			case bool:
+				if !additional {
+					v.AddError(fieldKey(field), fmt.Sprintf("%s is not a known field", fieldKey(field)))
+				}
+			}
+		}
+		required, _ := schema["required"].([]string)
+		for _, field := range required {
+			if _, ok := object[field]; !ok {
+				v.AddError(fieldKey(field), fmt.Sprintf("%s is required", fieldKey(field)))
+			}
+		}
+	case "array":
+		list, ok := value.([]interface{})
+		if !ok {
+			v.AddError(name, fmt.Sprintf("%s must be an array", name))
+			return
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range list {
+			s.validate(items, item, fmt.Sprintf("%s[%d]", name, i), v)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			v.AddError(name, fmt.Sprintf("%s must be a string", name))
+			return
+		}
+		if schema["format"] == "date-time" {
+			_, err := time.Parse(time.RFC3339, str)
+			if err != nil {
+				v.AddError(name, fmt.Sprintf("%s must be an RFC 3339 date-time", name))
+			}
+		}
+	case "integer":
+		number, ok := value.(float64)
+		if !ok || number != math.Trunc(number) {
+			v.AddError(name, fmt.Sprintf("%s must be an integer", name))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			v.AddError(name, fmt.Sprintf("%s must be a number", name))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			v.AddError(name, fmt.Sprintf("%s must be a boolean", name))
+		}
+	}
+}
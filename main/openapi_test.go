@@ -0,0 +1,301 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/priyanshu-gupta07/MovieFlix-backend/validator"
+)
+
+func TestOpenAPIPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/v1/movies", "/v1/movies"},
+		{"/v1/movie/:id", "/v1/movie/{id}"},
+		{"/v1/admin/pending/:type/:id", "/v1/admin/pending/{type}/{id}"},
+		{"/v1/user/login/", "/v1/user/login/"},
+	}
+
+	for _, tt := range tests {
+		if got := openAPIPath(tt.path); got != tt.want {
+			t.Errorf("openAPIPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestOperationID(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{http.MethodGet, "/v1/movie/:id", "getV1MovieId"},
+		{http.MethodPut, "/v1/me/notification-preferences", "putV1MeNotificationPreferences"},
+		{http.MethodPost, "/v1/user/login/", "postV1UserLogin"},
+		{http.MethodGet, "/v1/openapi.json", "getV1OpenapiJson"},
+	}
+
+	for _, tt := range tests {
+		if got := operationID(apiRoute{Method: tt.method, Path: tt.path}); got != tt.want {
+			t.Errorf("operationID(%s %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	saved := apiRoutes
+	defer func() { apiRoutes = saved }()
+	apiRoutes = []apiRoute{
+		{Method: http.MethodGet, Path: "/v1/items/:id"},
+		{Method: http.MethodGet, Path: "/v1/items/latest"},
+		{Method: http.MethodGet, Path: "/v1/items/:id/parts"},
+		{Method: http.MethodPost, Path: "/v1/items/:id"},
+	}
+
+	tests := []struct {
+		method     string
+		path       string
+		wantPath   string
+		wantParams map[string]string
+	}{
+		{http.MethodGet, "/v1/items/latest", "/v1/items/latest", map[string]string{}},
+		{http.MethodGet, "/v1/items/12", "/v1/items/:id", map[string]string{"id": "12"}},
+		{http.MethodGet, "/v1/items/12/parts", "/v1/items/:id/parts", map[string]string{"id": "12"}},
+		{http.MethodPost, "/v1/items/latest", "/v1/items/:id", map[string]string{"id": "latest"}},
+		{http.MethodGet, "/v1/items/", "", nil},
+		{http.MethodDelete, "/v1/items/12", "", nil},
+		{http.MethodGet, "/v1/other", "", nil},
+	}
+
+	spec := &openAPI{}
+	for _, tt := range tests {
+		route, params := spec.match(tt.method, tt.path)
+		if tt.wantPath == "" {
+			if route != nil {
+				t.Errorf("match(%s %s) = %s, want no route", tt.method, tt.path, route.Path)
+			}
+			continue
+		}
+		if route == nil || route.Path != tt.wantPath || route.Method != tt.method {
+			t.Errorf("match(%s %s) = %+v, want %s", tt.method, tt.path, route, tt.wantPath)
+			continue
+		}
+		if !reflect.DeepEqual(params, tt.wantParams) {
+			t.Errorf("match(%s %s) params = %v, want %v", tt.method, tt.path, params, tt.wantParams)
+		}
+	}
+}
+
+func TestValidateParam(t *testing.T) {
+	perPage := apiParam{Name: "per_page", In: "query", Type: "integer", Minimum: intPtr(1), Maximum: intPtr(100)}
+	include := apiParam{Name: "include", In: "query", Type: "string", Enum: []string{"comments", "ratings"}, List: true}
+	ids := apiParam{Name: "ids", In: "query", Type: "integer", Minimum: intPtr(1), List: true}
+	flag := apiParam{Name: "unread", In: "query", Type: "boolean"}
+
+	tests := []struct {
+		name  string
+		param apiParam
+		raw   string
+		want  string // the error, empty when the value is valid
+	}{
+		{"integer", perPage, "20", ""},
+		{"minimum", perPage, "1", ""},
+		{"maximum", perPage, "100", ""},
+		{"not an integer", perPage, "ten", "per_page must be an integer value"},
+		{"under the minimum", perPage, "0", "per_page must be at least 1"},
+		{"over the maximum", perPage, "101", "per_page must be at most 100"},
+		{"enum list", include, "comments, ratings", ""},
+		{"empty list items", include, "comments,,", ""},
+		{"list item out of the enum", include, "comments,cast", "include must be one of comments, ratings"},
+		{"integer list", ids, "1,2,3", ""},
+		{"integer list item", ids, "1,two", "ids must be an integer value"},
+		{"integer list minimum", ids, "1,0", "ids must be at least 1"},
+		{"boolean", flag, "true", ""},
+		{"not a boolean", flag, "yes", "unread must be a boolean value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			validateParam(tt.param, tt.raw, v)
+			if got := v.Errors[tt.param.Name]; got != tt.want {
+				t.Errorf("validateParam(%q) error = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+type testBody struct {
+	Title    string            `json:"title"`
+	Year     int               `json:"year"`
+	Note     string            `json:"note,omitempty"`
+	ParentID *int              `json:"parent_id"`
+	Released time.Time         `json:"released,omitempty"`
+	Cast     []testCastMember  `json:"cast"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Hidden   string            `json:"-"`
+}
+
+type testCastMember struct {
+	Name  string   `json:"name"`
+	Order *float64 `json:"order"`
+}
+
+func TestSchemaRequired(t *testing.T) {
+	reg := &schemaRegistry{components: make(map[string]interface{})}
+	schema := reg.resolve(reg.schema(reflect.TypeOf(testBody{})))
+
+	if want := []string{"title", "year", "cast"}; !reflect.DeepEqual(schema["required"], want) {
+		t.Errorf("required = %v, want %v", schema["required"], want)
+	}
+	if schema["additionalProperties"] != false {
+		t.Errorf("additionalProperties = %v, want false", schema["additionalProperties"])
+	}
+	if _, ok := schema["properties"].(map[string]interface{})["Hidden"]; ok {
+		t.Errorf("a field tagged json:\"-\" is described")
+	}
+
+	cast := reg.resolve(reg.schema(reflect.TypeOf(testCastMember{})))
+	if want := []string{"name"}; !reflect.DeepEqual(cast["required"], want) {
+		t.Errorf("required of the cast = %v, want %v", cast["required"], want)
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	reg := &schemaRegistry{components: make(map[string]interface{})}
+	schema := reg.schema(reflect.TypeOf(testBody{}))
+
+	valid := map[string]interface{}{
+		"title":     "Heat",
+		"year":      float64(1995),
+		"parent_id": nil,
+		"released":  "1995-12-15T00:00:00Z",
+		"cast": []interface{}{
+			map[string]interface{}{"name": "Al Pacino", "order": 1.5},
+			map[string]interface{}{"name": "Robert De Niro", "order": nil},
+		},
+		"labels": map[string]interface{}{"country": "US"},
+	}
+
+	tests := []struct {
+		name string
+		edit func(body map[string]interface{}) interface{}
+		want map[string]string
+	}{
+		{"valid", func(body map[string]interface{}) interface{} { return body }, map[string]string{}},
+		{"not an object", func(body map[string]interface{}) interface{} { return []interface{}{} },
+			map[string]string{"body": "body must be an object"}},
+		{"missing required fields", func(body map[string]interface{}) interface{} {
+			delete(body, "title")
+			delete(body, "cast")
+			return body
+		}, map[string]string{"title": "title is required", "cast": "cast is required"}},
+		{"optional fields left out", func(body map[string]interface{}) interface{} {
+			delete(body, "parent_id")
+			delete(body, "released")
+			delete(body, "labels")
+			return body
+		}, map[string]string{}},
+		{"unknown field", func(body map[string]interface{}) interface{} {
+			body["rating"] = 5.0
+			return body
+		}, map[string]string{"rating": "rating is not a known field"}},
+		{"wrong types", func(body map[string]interface{}) interface{} {
+			body["title"] = 12.0
+			body["year"] = 1995.5
+			body["released"] = "yesterday"
+			return body
+		}, map[string]string{
+			"title":    "title must be a string",
+			"year":     "year must be an integer",
+			"released": "released must be an RFC 3339 date-time",
+		}},
+		{"null required field", func(body map[string]interface{}) interface{} {
+			body["title"] = nil
+			return body
+		}, map[string]string{"title": "title must not be null"}},
+		{"nested array items", func(body map[string]interface{}) interface{} {
+			body["cast"] = []interface{}{
+				map[string]interface{}{"name": "Val Kilmer", "order": "first"},
+				map[string]interface{}{"order": 2.0, "role": "Chris"},
+				"Jon Voight",
+			}
+			return body
+		}, map[string]string{
+			"cast[0].order": "cast[0].order must be a number",
+			"cast[1].name":  "cast[1].name is required",
+			"cast[1].role":  "cast[1].role is not a known field",
+			"cast[2]":       "cast[2] must be an object",
+		}},
+		{"not an array", func(body map[string]interface{}) interface{} {
+			body["cast"] = map[string]interface{}{}
+			return body
+		}, map[string]string{"cast": "cast must be an array"}},
+		{"map values", func(body map[string]interface{}) interface{} {
+			body["labels"] = map[string]interface{}{"country": true}
+			return body
+		}, map[string]string{"labels.country": "labels.country must be a string"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := make(map[string]interface{}, len(valid))
+			for key, value := range valid {
+				body[key] = value
+			}
+
+			v := validator.New()
+			reg.validate(schema, tt.edit(body), "", v)
+			if !reflect.DeepEqual(v.Errors, tt.want) {
+				t.Errorf("validate() errors = %v, want %v", v.Errors, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoutesAreDocumented(t *testing.T) {
+	// routes() panics when a route is missing from apiRoutes or the router
+	(&application{}).routes()
+}
+
+func TestCheckAPIRoutes(t *testing.T) {
+	handler := func(http.ResponseWriter, *http.Request) {}
+
+	documented := func() *routeRecorder {
+		router := newRouteRecorder()
+		for _, route := range apiRoutes {
+			router.HandlerFunc(route.Method, route.Path, handler)
+		}
+		return router
+	}
+
+	assertPanic := func(name string, router *routeRecorder, want string) {
+		t.Helper()
+		defer func() {
+			r := recover()
+			msg, _ := r.(string)
+			if !strings.Contains(msg, want) {
+				t.Errorf("%s: checkAPIRoutes() panicked with %v, want %q", name, r, want)
+			}
+		}()
+		checkAPIRoutes(router)
+	}
+
+	checkAPIRoutes(documented())
+
+	router := documented()
+	router.HandlerFunc(http.MethodGet, "/v1/undocumented", handler)
+	assertPanic("registered route", router, "GET /v1/undocumented is registered but not documented")
+
+	router = newRouteRecorder()
+	for _, route := range apiRoutes[1:] {
+		router.HandlerFunc(route.Method, route.Path, handler)
+	}
+	first := apiRoutes[0].Method + " " + apiRoutes[0].Path
+	assertPanic("documented route", router, first+" is documented but not registered")
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/models"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/validator"
+)
+
+type RatingPayload struct {
+	Rating float64 `json:"rating"`
+}
+
+// ratingExportRow is a line of the rating history export
+type ratingExportRow struct {
+	MovieID int       `json:"movie_id"`
+	Title   string    `json:"title"`
+	Year    int       `json:"year"`
+	Rating  float64   `json:"rating"`
+	RatedAt time.Time `json:"rated_at"`
+}
+
+// rate a movie, a second submission replaces the rating of the user
+func (app *application) rateMovie(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	movieID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	userID, ok := app.authenticatedUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authorization header is required"), http.StatusUnauthorized)
+		return
+	}
+
+	var payload RatingPayload
+	err = app.readJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, errors.New("invalid json request"))
+		return
+	}
+
+	v := validator.New()
+	v.IsRating(payload.Rating, "rating")
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	now := time.Now()
+	rating := models.Rating{
+		MovieID:   movieID,
+		UserID:    userID,
+		Rating:    float32(payload.Rating),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	created, err := app.models.Db.InsertRating(&rating)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("movie not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to save the rating"), http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	app.writeJSON(w, status, rating, "rating")
+}
+
+// delete the rating of the user for a movie
+func (app *application) deleteRating(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	movieID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	userID, ok := app.authenticatedUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authorization header is required"), http.StatusUnauthorized)
+		return
+	}
+
+	err = app.models.Db.DeleteRating(movieID, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("rating not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to delete the rating"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{OK: true, Message: "rating deleted successfully"})
+}
+
+// readRatingsFilter reads the ?sort= and ?genre_id= of the rating history
+func (app *application) readRatingsFilter(qs url.Values, v *validator.Validator) models.MovieFilter {
+	filter := models.MovieFilter{
+		OrderBy:       qs.Get("sort"),
+		FilterByGenre: app.readInt(qs, "genre_id", 0, v),
+	}
+	if filter.OrderBy == "" {
+		filter.OrderBy = "recent"
+	}
+
+	v.Check(validator.In(filter.OrderBy, "recent", "highest", "lowest"), "sort", "sort must be one of recent, highest, lowest")
+	v.Check(filter.FilterByGenre >= 0, "genre_id", "genre_id must be a positive number")
+
+	return filter
+}
+
+// get a page of the movies rated by the user, with their score
+func (app *application) getMyRatings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.authenticatedUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authorization header is required"), http.StatusUnauthorized)
+		return
+	}
+
+	qs := r.URL.Query()
+	v := validator.New()
+	filter := app.readRatingsFilter(qs, v)
+
+	page := app.readInt(qs, "page", 1, v)
+	v.Check(page >= 1, "page", "page must be greater than zero")
+
+	perPage := app.readInt(qs, "per_page", 20, v)
+	v.Check(perPage >= 1 && perPage <= 100, "per_page", "per_page must be between 1 and 100")
+
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	ratings, err := app.models.Db.GetUserRatings(userID, filter, page, perPage, app.movieOptions(r, nil))
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the ratings"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, ratings)
+}
+
+// download every rating of the user as a csv file
+func (app *application) exportMyRatings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.authenticatedUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authorization header is required"), http.StatusUnauthorized)
+		return
+	}
+
+	v := validator.New()
+	filter := app.readRatingsFilter(r.URL.Query(), v)
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	// only the movie columns are needed for the export
+	fields := models.FieldSet{"id": true, "title": true}
+	ratings, err := app.models.Db.GetUserRatings(userID, filter, 1, 0, models.MovieOptions{Fields: fields})
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to export the ratings"), http.StatusInternalServerError)
+		return
+	}
+
+	rows := make([]ratingExportRow, 0, len(ratings.Movies))
+	for _, movie := range ratings.Movies {
+		rows = append(rows, ratingExportRow{
+			MovieID: movie.ID,
+			Title:   movie.Title,
+			Year:    movie.Year,
+			Rating:  *movie.MyRating,
+			RatedAt: *movie.RatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="my-ratings.csv"`)
+	err = writeCSV(w, http.StatusOK, rows)
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, err)
+		return
+	}
+}
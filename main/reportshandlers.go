@@ -0,0 +1,326 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/models"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/validator"
+)
+
+type ReportPayload struct {
+	TargetType string `json:"target_type"`
+	TargetID   int    `json:"target_id"`
+	Reason     string `json:"reason"`
+	Details    string `json:"details,omitempty"`
+}
+
+type ModerationActionPayload struct {
+	Action string `json:"action"`
+	Note   string `json:"note,omitempty"`
+}
+
+type SuspensionPayload struct {
+	Note string `json:"note,omitempty"`
+}
+
+// report a comment, a review or a user to the moderators
+func (app *application) insertReport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.authenticatedUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authorization header is required"), http.StatusUnauthorized)
+		return
+	}
+
+	var payload ReportPayload
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, errors.New("invalid json request"))
+		return
+	}
+
+	payload.Details = strings.TrimSpace(payload.Details)
+
+	v := validator.New()
+	v.Check(validator.In(payload.TargetType, models.ReportTargets...), "target_type", "target_type must be one of "+strings.Join(models.ReportTargets, ", "))
+	v.Check(payload.TargetID > 0, "target_id", "target_id is required")
+	v.Check(validator.In(payload.Reason, models.ReportReasons...), "reason", "reason must be one of "+strings.Join(models.ReportReasons, ", "))
+	v.IsLength(payload.Details, "details", 0, 2000)
+	v.Check(payload.TargetType != "user" || payload.TargetID != userID, "target_id", "you can't report yourself")
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	now := time.Now()
+	report := models.Report{
+		ReporterID: userID,
+		TargetType: payload.TargetType,
+		TargetID:   payload.TargetID,
+		Reason:     payload.Reason,
+		Details:    payload.Details,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	err = app.models.Db.InsertReport(&report)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.errorJSON(w, errors.New(payload.TargetType+" not found"), http.StatusNotFound)
+		case errors.Is(err, models.ErrDuplicateReport):
+			app.errorJSON(w, err, http.StatusConflict)
+		default:
+			app.logger.Println(err)
+			app.errorJSON(w, errors.New("failed to save the report"), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, report, "report")
+}
+
+// get a page of the moderation queue, ?status= defaults to the open reports
+func (app *application) getReports(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	filter := models.ReportFilter{Status: qs.Get("status"), TargetType: qs.Get("target_type")}
+	if filter.Status == "" {
+		filter.Status = "open"
+	}
+	v.Check(filter.Status == "all" || validator.In(filter.Status, models.ReportStatuses...), "status", "status must be all or one of "+strings.Join(models.ReportStatuses, ", "))
+	v.Check(filter.TargetType == "" || validator.In(filter.TargetType, models.ReportTargets...), "target_type", "target_type must be one of "+strings.Join(models.ReportTargets, ", "))
+	if filter.Status == "all" {
+		filter.Status = ""
+	}
+
+	page := app.readInt(qs, "page", 1, v)
+	v.Check(page >= 1, "page", "page must be greater than zero")
+
+	perPage := app.readInt(qs, "per_page", 20, v)
+	v.Check(perPage >= 1 && perPage <= 100, "per_page", "per_page must be between 1 and 100")
+
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	reports, err := app.models.Db.GetReports(filter, page, perPage)
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the reports"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, reports)
+}
+
+// get a report with the actions the moderators took on it
+func (app *application) getReport(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	report, err := app.models.Db.GetReport(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("report not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the report"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, report, "report")
+}
+
+// applyModerationAction records the decision of the moderator making the request and answers with the report,
+// or the action itself when it isn't taken on a report. It reports whether the action was carried out.
+func (app *application) applyModerationAction(w http.ResponseWriter, r *http.Request, action *models.ModerationAction) bool {
+	moderatorID, ok := app.authenticatedUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authorization header is required"), http.StatusUnauthorized)
+		return false
+	}
+
+	action.ModeratorID = moderatorID
+	action.Note = strings.TrimSpace(action.Note)
+	action.CreatedAt = time.Now()
+
+	err := app.models.Db.ApplyModerationAction(action)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.errorJSON(w, errors.New("report or target not found"), http.StatusNotFound)
+		case errors.Is(err, models.ErrInvalidAction):
+			app.errorJSON(w, err, http.StatusConflict)
+		default:
+			app.logger.Println(err)
+			app.errorJSON(w, errors.New("failed to apply the moderation action"), http.StatusInternalServerError)
+		}
+		return false
+	}
+
+	if action.ReportID == nil {
+		app.writeJSON(w, http.StatusOK, action, "action")
+		return true
+	}
+
+	report, err := app.models.Db.GetReport(*action.ReportID)
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the report"), http.StatusInternalServerError)
+		return true
+	}
+
+	app.writeJSON(w, http.StatusOK, report, "report")
+	return true
+}
+
+// take a moderation action on a report: triage, resolve, dismiss, approve or hide the content or suspend its author
+func (app *application) moderateReport(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	var payload ModerationActionPayload
+	err = app.readJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, errors.New("invalid json request"))
+		return
+	}
+
+	v := validator.New()
+	v.Check(validator.In(payload.Action, models.ModerationActions...), "action", "action must be one of "+strings.Join(models.ModerationActions, ", "))
+	v.IsLength(payload.Note, "note", 0, 2000)
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	app.applyModerationAction(w, r, &models.ModerationAction{ReportID: &id, Action: payload.Action, Note: payload.Note})
+}
+
+// suspend a user, or lift the suspension with DELETE
+func (app *application) setUserSuspension(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	action := models.ModerationAction{Action: "suspend", TargetType: "user", TargetID: id}
+	if r.Method == http.MethodDelete {
+		action.Action = "unsuspend"
+	}
+
+	// the note is optional, DELETE requests usually come without a body
+	if r.ContentLength != 0 {
+		var payload SuspensionPayload
+		err = app.readJSON(w, r, &payload)
+		if err != nil {
+			app.badRequest(w, r, errors.New("invalid json request"))
+			return
+		}
+		action.Note = payload.Note
+	}
+
+	app.applyModerationAction(w, r, &action)
+}
+
+// get a page of the comments and reviews the moderation filter held back, oldest first
+func (app *application) getPendingContent(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	targetType := qs.Get("target_type")
+	v.Check(targetType == "" || validator.In(targetType, models.PendingTargets...), "target_type", "target_type must be one of "+strings.Join(models.PendingTargets, ", "))
+
+	page := app.readInt(qs, "page", 1, v)
+	v.Check(page >= 1, "page", "page must be greater than zero")
+
+	perPage := app.readInt(qs, "per_page", 20, v)
+	v.Check(perPage >= 1 && perPage <= 100, "per_page", "per_page must be between 1 and 100")
+
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	content, err := app.models.Db.GetPendingContent(targetType, page, perPage)
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the pending content"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, content)
+}
+
+// approve a comment or review held for moderation so it gets published, or reject it to keep it hidden
+func (app *application) moderatePendingContent(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	targetType := params.ByName("type")
+	if !validator.In(targetType, models.PendingTargets...) {
+		app.errorJSON(w, errors.New("type must be one of "+strings.Join(models.PendingTargets, ", ")))
+		return
+	}
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	var payload ModerationActionPayload
+	err = app.readJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, errors.New("invalid json request"))
+		return
+	}
+
+	v := validator.New()
+	v.Check(validator.In(payload.Action, models.PendingActions...), "action", "action must be one of "+strings.Join(models.PendingActions, ", "))
+	v.IsLength(payload.Note, "note", 0, 2000)
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	// the reply was not announced while it was held back, it is once approved
+	var reply *models.Comment
+	if targetType == "comment" && payload.Action == "approve" {
+		comment, err := app.models.Db.GetComment(id)
+		if err == nil && comment.Status == models.StatusPending && comment.ParentID != nil {
+			reply = comment
+		}
+	}
+
+	applied := app.applyModerationAction(w, r, &models.ModerationAction{Action: payload.Action, TargetType: targetType, TargetID: id, Note: payload.Note})
+
+	// a failed notification doesn't undo the approval
+	if applied && reply != nil {
+		err = app.models.Db.NotifyReply(reply)
+		if err != nil {
+			app.logger.Println(err)
+		}
+	}
+}
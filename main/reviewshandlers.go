@@ -0,0 +1,418 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/models"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/validator"
+)
+
+// ReviewPayload is a review sent by its author, the rating is optional and saved as the rating
+// of the author for the movie
+type ReviewPayload struct {
+	Title   string   `json:"title"`
+	Body    string   `json:"body"`
+	Spoiler bool     `json:"spoiler,omitempty"`
+	Rating  *float64 `json:"rating"`
+}
+
+// readReviewID reads the :id of the review routes
+func (app *application) readReviewID(r *http.Request) (int, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		return 0, errors.New("invalid id parameter")
+	}
+	return id, nil
+}
+
+// hideSpoilers empties the body of the spoiler reviews, clients ask for them with ?spoilers=true
+func hideSpoilers(reviews ...*models.Review) {
+	for _, review := range reviews {
+		if review.Spoiler {
+			review.Body = ""
+			review.BodyHidden = true
+		}
+	}
+}
+
+// validateReview checks the review payload sent by its author
+func (app *application) validateReview(payload *ReviewPayload) *validator.Validator {
+	v := validator.New()
+
+	payload.Title = strings.TrimSpace(payload.Title)
+	v.Check(payload.Title != "", "title", "title is required")
+	v.IsLength(payload.Title, "title", 2, 255)
+
+	payload.Body = strings.TrimSpace(payload.Body)
+	v.Check(payload.Body != "", "body", "body is required")
+	v.IsLength(payload.Body, "body", 50, 20000)
+
+	if payload.Rating != nil {
+		v.IsRating(*payload.Rating, "rating")
+	}
+
+	return v
+}
+
+// reviewRating returns the rating sent with a review, saved along with it, or nil when none was sent
+func reviewRating(review *models.Review, payload *ReviewPayload) *models.Rating {
+	if payload.Rating == nil {
+		return nil
+	}
+
+	now := time.Now()
+	return &models.Rating{
+		MovieID:   review.MovieID,
+		UserID:    review.UserID,
+		Rating:    float32(*payload.Rating),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// get a page of the reviews of a movie, ?sort=helpful|recent
+func (app *application) getMovieReviews(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	movieID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	qs := r.URL.Query()
+	v := validator.New()
+
+	sort := qs.Get("sort")
+	if sort == "" {
+		sort = "helpful"
+	}
+	v.Check(validator.In(sort, "helpful", "recent"), "sort", "sort must be one of helpful, recent")
+
+	page := app.readInt(qs, "page", 1, v)
+	v.Check(page >= 1, "page", "page must be greater than zero")
+
+	perPage := app.readInt(qs, "per_page", 20, v)
+	v.Check(perPage >= 1 && perPage <= 100, "per_page", "per_page must be between 1 and 100")
+
+	spoilers := app.readBool(qs, "spoilers", false, v)
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	viewerID, _ := app.authenticatedUserID(r)
+	reviews, err := app.models.Db.GetMovieReviews(movieID, sort, page, perPage, viewerID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("movie not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the reviews"), http.StatusInternalServerError)
+		return
+	}
+
+	if !spoilers {
+		hideSpoilers(reviews.Reviews...)
+	}
+
+	app.writeJSON(w, http.StatusOK, reviews)
+}
+
+// get one review
+func (app *application) getReview(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readReviewID(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	v := validator.New()
+	spoilers := app.readBool(r.URL.Query(), "spoilers", false, v)
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	viewerID, _ := app.authenticatedUserID(r)
+	review, err := app.models.Db.GetReview(id, viewerID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("review not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the review"), http.StatusInternalServerError)
+		return
+	}
+
+	// reviews waiting for moderation are only shown to their author
+	if review.Status != models.StatusPublished && review.UserID != viewerID {
+		app.errorJSON(w, errors.New("review not found"), http.StatusNotFound)
+		return
+	}
+
+	if !spoilers {
+		hideSpoilers(review)
+	}
+
+	app.writeJSON(w, http.StatusOK, review, "review")
+}
+
+// review a movie, a user writes one review per movie
+func (app *application) insertReview(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	movieID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	userID, ok := app.authenticatedUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authorization header is required"), http.StatusUnauthorized)
+		return
+	}
+
+	var payload ReviewPayload
+	err = app.readJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, errors.New("invalid json request"))
+		return
+	}
+
+	v := app.validateReview(&payload)
+	status := app.moderate(v, userID, map[string]string{"title": payload.Title, "body": payload.Body})
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	now := time.Now()
+	review := models.Review{
+		MovieID:   movieID,
+		UserID:    userID,
+		Title:     payload.Title,
+		Body:      payload.Body,
+		Spoiler:   payload.Spoiler,
+		Status:    status,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	err = app.models.Db.InsertReview(&review, reviewRating(&review, &payload))
+	if err != nil {
+		app.moderation.Release(userID)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.errorJSON(w, errors.New("movie not found"), http.StatusNotFound)
+		case errors.Is(err, models.ErrDuplicateReview):
+			app.errorJSON(w, err, http.StatusConflict)
+		default:
+			app.logger.Println(err)
+			app.errorJSON(w, errors.New("failed to save the review"), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	saved, err := app.models.Db.GetReview(review.ID, userID)
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the review"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, saved, "review")
+}
+
+// ownReview loads a review for its author, it answers 404 or 403 and returns nil otherwise
+func (app *application) ownReview(w http.ResponseWriter, r *http.Request) *models.Review {
+	id, err := app.readReviewID(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return nil
+	}
+
+	userID, ok := app.authenticatedUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authorization header is required"), http.StatusUnauthorized)
+		return nil
+	}
+
+	review, err := app.models.Db.GetReview(id, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("review not found"), http.StatusNotFound)
+			return nil
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the review"), http.StatusInternalServerError)
+		return nil
+	}
+
+	if review.UserID != userID {
+		app.errorJSON(w, errors.New("only the author can change a review"), http.StatusForbidden)
+		return nil
+	}
+
+	return review
+}
+
+// update a review, a rating left out keeps the linked rating
+func (app *application) updateReview(w http.ResponseWriter, r *http.Request) {
+	review := app.ownReview(w, r)
+	if review == nil {
+		return
+	}
+
+	var payload ReviewPayload
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, errors.New("invalid json request"))
+		return
+	}
+
+	v := app.validateReview(&payload)
+	status := app.moderate(v, 0, map[string]string{"title": payload.Title, "body": payload.Body})
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	review.Title = payload.Title
+	// editing doesn't bring back a review hidden by a moderator
+	if review.Status != models.StatusHidden {
+		review.Status = status
+	}
+	review.Body = payload.Body
+	review.Spoiler = payload.Spoiler
+	review.UpdatedAt = time.Now()
+
+	err = app.models.Db.UpdateReview(review, reviewRating(review, &payload))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("review not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to update the review"), http.StatusInternalServerError)
+		return
+	}
+
+	saved, err := app.models.Db.GetReview(review.ID, review.UserID)
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the review"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, saved, "review")
+}
+
+// delete a review, the linked rating is kept
+func (app *application) deleteReview(w http.ResponseWriter, r *http.Request) {
+	review := app.ownReview(w, r)
+	if review == nil {
+		return
+	}
+
+	err := app.models.Db.DeleteReview(review.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("review not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to delete the review"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{OK: true, Message: "review deleted successfully"})
+}
+
+// vote a review helpful, authors can't vote their own reviews
+func (app *application) voteReviewHelpful(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readReviewID(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	userID, ok := app.authenticatedUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authorization header is required"), http.StatusUnauthorized)
+		return
+	}
+
+	review, err := app.models.Db.GetReview(id, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("review not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to fetch the review"), http.StatusInternalServerError)
+		return
+	}
+
+	if review.Status != models.StatusPublished {
+		app.errorJSON(w, errors.New("review not found"), http.StatusNotFound)
+		return
+	}
+
+	if review.UserID == userID {
+		app.errorJSON(w, errors.New("you can't vote your own review"), http.StatusForbidden)
+		return
+	}
+
+	err = app.models.Db.VoteReviewHelpful(id, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("review not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to save the vote"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{OK: true, Message: "review voted helpful"})
+}
+
+// remove the helpful vote of the user
+func (app *application) unvoteReviewHelpful(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readReviewID(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	userID, ok := app.authenticatedUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authorization header is required"), http.StatusUnauthorized)
+		return
+	}
+
+	err = app.models.Db.UnvoteReviewHelpful(id, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("vote not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to delete the vote"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{OK: true, Message: "vote deleted successfully"})
+}
@@ -2,8 +2,6 @@ package main
 
 import (
 	"net/http"
-
-	"github.com/julienschmidt/httprouter"
 )
 
 // wrap function for multiple middlewares
@@ -17,8 +15,7 @@ import (
 // }
 
 func (app *application) routes() http.Handler {
-	router := httprouter.New()
-
+	router := newRouteRecorder()
 
 	// // initialize secure middleware
 	// secure := alice.New(app.authenticate)
@@ -28,16 +25,90 @@ func (app *application) routes() http.Handler {
 
 	// Define your routes here
 	router.HandlerFunc(http.MethodGet, "/v1/status", app.GetStatus)
-	router.HandlerFunc(http.MethodGet, "/v1/movies", app.getAllMovies)
-	router.HandlerFunc(http.MethodGet, "/v1/genres", app.GetAllGenres)
-	router.HandlerFunc(http.MethodGet, "/v1/movies/latest", app.GetLatestMovies)
-	router.HandlerFunc(http.MethodGet, "/v1/movies/genre/:genre_id", app.getAllMoviesByGenre)
-	router.HandlerFunc(http.MethodGet, "/v1/movie/:id", app.getOneMovie)
+
+	// read endpoints answer conditional requests, listings change more often than the catalog structure.
+	// Movie endpoints set the is_favorite, my_rating and in_watchlist flags when a valid token is sent.
+	router.Handler(http.MethodGet, "/v1/movies", app.optionalAuth(app.conditionalGET("public, max-age=60", http.HandlerFunc(app.getAllMovies))))
+	router.Handler(http.MethodPost, "/v1/movies/batch", app.optionalAuth(http.HandlerFunc(app.getMovieBatch)))
+	router.Handler(http.MethodGet, "/v1/genres", app.conditionalGET("public, max-age=300", http.HandlerFunc(app.GetAllGenres)))
+	router.Handler(http.MethodGet, "/v1/genres/stats", app.conditionalGET("public, max-age=300", http.HandlerFunc(app.getGenreStats)))
+	router.Handler(http.MethodGet, "/v1/genre/:id", app.conditionalGET("public, max-age=300", http.HandlerFunc(app.getOneGenre)))
+	router.Handler(http.MethodGet, "/v1/movies/latest", app.optionalAuth(app.conditionalGET("public, max-age=30", http.HandlerFunc(app.GetLatestMovies))))
+	router.Handler(http.MethodGet, "/v1/movies/top", app.optionalAuth(app.conditionalGET("public, max-age=300", http.HandlerFunc(app.getTopMovies))))
+	router.Handler(http.MethodGet, "/v1/movies/genre/:genre_id", app.optionalAuth(app.conditionalGET("public, max-age=60", http.HandlerFunc(app.getAllMoviesByGenre))))
+	router.Handler(http.MethodGet, "/v1/movie/:id", app.optionalAuth(app.conditionalGET("public, max-age=60", http.HandlerFunc(app.getOneMovie))))
+	router.Handler(http.MethodGet, "/v1/movie/:id/ratings/summary", app.conditionalGET("public, max-age=60", http.HandlerFunc(app.getRatingSummary)))
+
+	router.Handler(http.MethodGet, "/v1/movie/:id/comments", app.optionalAuth(app.conditionalGET("public, max-age=30", http.HandlerFunc(app.getMovieComments))))
+	router.Handler(http.MethodGet, "/v1/comments/:id/replies", app.optionalAuth(app.conditionalGET("public, max-age=30", http.HandlerFunc(app.getCommentReplies))))
+
+	// reviews set voted_helpful for the user of a valid token
+	router.Handler(http.MethodGet, "/v1/movie/:id/reviews", app.optionalAuth(app.conditionalGET("public, max-age=60", http.HandlerFunc(app.getMovieReviews))))
+	router.Handler(http.MethodGet, "/v1/reviews/:id", app.optionalAuth(app.conditionalGET("public, max-age=60", http.HandlerFunc(app.getReview))))
+
+	router.Handler(http.MethodGet, "/v1/tags", app.conditionalGET("public, max-age=300", http.HandlerFunc(app.getAllTags)))
+	router.Handler(http.MethodGet, "/v1/tags/:slug/movies", app.optionalAuth(app.conditionalGET("public, max-age=60", http.HandlerFunc(app.getMoviesByTag))))
+
+	// graphql queries over the catalog, GET for cacheable queries and POST for the rest
+	graphqlHandler := app.graphqlHandler(app.graphqlSchema())
+	router.Handler(http.MethodGet, "/v1/graphql", graphqlHandler)
+	router.Handler(http.MethodPost, "/v1/graphql", graphqlHandler)
+
+	// machine readable description of the routes, see apiRoutes
+	spec := newOpenAPI()
+	router.Handler(http.MethodGet, "/v1/openapi.json", app.conditionalGET("public, max-age=3600", app.getOpenAPI(spec)))
+
+	// user routes
+	router.Handler(http.MethodPut, "/v1/movie/:id/rating", app.authenticate(http.HandlerFunc(app.rateMovie)))
+	router.Handler(http.MethodDelete, "/v1/movie/:id/rating", app.authenticate(http.HandlerFunc(app.deleteRating)))
+	router.Handler(http.MethodGet, "/v1/me/ratings", app.authenticate(http.HandlerFunc(app.getMyRatings)))
+	router.Handler(http.MethodGet, "/v1/me/ratings/export", app.authenticate(http.HandlerFunc(app.exportMyRatings)))
+	router.Handler(http.MethodGet, "/v1/me/notifications", app.authenticate(http.HandlerFunc(app.getMyNotifications)))
+	router.Handler(http.MethodPatch, "/v1/me/notifications/:id", app.authenticate(http.HandlerFunc(app.markNotification)))
+	router.Handler(http.MethodPost, "/v1/me/notifications/read-all", app.authenticate(http.HandlerFunc(app.markAllNotificationsRead)))
+	router.Handler(http.MethodGet, "/v1/me/notification-preferences", app.authenticate(http.HandlerFunc(app.getNotificationPreferences)))
+	router.Handler(http.MethodPut, "/v1/me/notification-preferences", app.authenticate(http.HandlerFunc(app.setNotificationPreferences)))
+	router.Handler(http.MethodPost, "/v1/reports", app.authenticate(http.HandlerFunc(app.insertReport)))
+	router.Handler(http.MethodPost, "/v1/movie/:id/comments", app.authenticate(http.HandlerFunc(app.insertComment)))
+	router.Handler(http.MethodPatch, "/v1/comments/:id", app.authenticate(http.HandlerFunc(app.updateComment)))
+	router.Handler(http.MethodDelete, "/v1/comments/:id", app.authenticate(http.HandlerFunc(app.deleteComment)))
+	router.Handler(http.MethodPut, "/v1/comments/:id/reaction", app.authenticate(http.HandlerFunc(app.setCommentReaction)))
+	router.Handler(http.MethodDelete, "/v1/comments/:id/reaction", app.authenticate(http.HandlerFunc(app.deleteCommentReaction)))
+	router.Handler(http.MethodPost, "/v1/movie/:id/reviews", app.authenticate(http.HandlerFunc(app.insertReview)))
+	router.Handler(http.MethodPut, "/v1/reviews/:id", app.authenticate(http.HandlerFunc(app.updateReview)))
+	router.Handler(http.MethodDelete, "/v1/reviews/:id", app.authenticate(http.HandlerFunc(app.deleteReview)))
+	router.Handler(http.MethodPut, "/v1/reviews/:id/helpful", app.authenticate(http.HandlerFunc(app.voteReviewHelpful)))
+	router.Handler(http.MethodDelete, "/v1/reviews/:id/helpful", app.authenticate(http.HandlerFunc(app.unvoteReviewHelpful)))
 
 	router.HandlerFunc(http.MethodPost, "/v1/user/signup/", app.signUp)
 	router.HandlerFunc(http.MethodPost, "/v1/user/login/", app.loginUser)
 
-	// Add more routes as needed
+	// admin routes
+	router.Handler(http.MethodPost, "/v1/admin/genres", app.adminAuth(http.HandlerFunc(app.insertGenre)))
+	router.Handler(http.MethodPut, "/v1/admin/genres/:id", app.adminAuth(http.HandlerFunc(app.updateGenre)))
+	router.Handler(http.MethodDelete, "/v1/admin/genres/:id", app.adminAuth(http.HandlerFunc(app.deleteGenre)))
+	router.Handler(http.MethodPost, "/v1/admin/genres/:id/merge", app.adminAuth(http.HandlerFunc(app.mergeGenre)))
+	router.Handler(http.MethodPost, "/v1/admin/tags", app.adminAuth(http.HandlerFunc(app.insertTag)))
+	router.Handler(http.MethodPut, "/v1/admin/tags/:id", app.adminAuth(http.HandlerFunc(app.updateTag)))
+	router.Handler(http.MethodDelete, "/v1/admin/tags/:id", app.adminAuth(http.HandlerFunc(app.deleteTag)))
+	router.Handler(http.MethodPut, "/v1/admin/movies/:id/tags", app.adminAuth(http.HandlerFunc(app.setMovieTags)))
+
+	// moderation queue, every decision is recorded in moderation_actions
+	router.Handler(http.MethodGet, "/v1/admin/reports", app.adminAuth(http.HandlerFunc(app.getReports)))
+	router.Handler(http.MethodGet, "/v1/admin/reports/:id", app.adminAuth(http.HandlerFunc(app.getReport)))
+	router.Handler(http.MethodPost, "/v1/admin/reports/:id/actions", app.adminAuth(http.HandlerFunc(app.moderateReport)))
+	router.Handler(http.MethodGet, "/v1/admin/pending", app.adminAuth(http.HandlerFunc(app.getPendingContent)))
+	router.Handler(http.MethodPost, "/v1/admin/pending/:type/:id", app.adminAuth(http.HandlerFunc(app.moderatePendingContent)))
+	router.Handler(http.MethodPut, "/v1/admin/users/:id/suspension", app.adminAuth(http.HandlerFunc(app.setUserSuspension)))
+	router.Handler(http.MethodDelete, "/v1/admin/users/:id/suspension", app.adminAuth(http.HandlerFunc(app.setUserSuspension)))
+
+	// Add more routes as needed, and document them in apiRoutes
+	checkAPIRoutes(router)
+
+	var handler http.Handler = router
+	if app.config.api.validateRequests {
+		handler = app.validateRequest(spec, handler)
+	}
 
-	return app.enableCORS(router)
+	return app.enableCORS(handler)
 }
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/models"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/validator"
+)
+
+type TagPayload struct {
+	Name string `json:"name"`
+}
+
+type MovieTagsPayload struct {
+	TagIDs []int `json:"tag_ids"`
+}
+
+// get all tags, ?q= searches them by name
+func (app *application) getAllTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := app.models.Db.GetAllTags(strings.TrimSpace(r.URL.Query().Get("q")))
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, tags, "tags")
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// get all movies having the tag
+func (app *application) getMoviesByTag(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	slug := params.ByName("slug")
+
+	v := validator.New()
+	fields := app.readFields(r.URL.Query(), v)
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	_, err := app.models.Db.GetTagBySlug(slug)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("tag not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, err)
+		return
+	}
+
+	movies, err := app.models.Db.GetMoviesByTag(slug, app.movieOptions(r, fields))
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, err)
+		return
+	}
+
+	app.setMoviesLastModified(w, movies...)
+	err = app.writeMovies(w, r, http.StatusOK, movies, fields, "movies")
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// validateTag checks the tag payload sent by an admin
+func (app *application) validateTag(payload TagPayload) *validator.Validator {
+	v := validator.New()
+	name := strings.TrimSpace(payload.Name)
+	v.Check(name != "", "name", "name is required")
+	v.IsLength(name, "name", 2, 100)
+	v.Check(models.Slugify(name) != "", "name", "name must contain at least one letter or number")
+	return v
+}
+
+// create a new tag
+func (app *application) insertTag(w http.ResponseWriter, r *http.Request) {
+	var payload TagPayload
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, errors.New("invalid json request"))
+		return
+	}
+
+	v := app.validateTag(payload)
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	tag, err := app.models.Db.InsertTag(payload.Name)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateTag) {
+			app.errorJSON(w, err, http.StatusConflict)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to save the tag"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, tag, "tag")
+}
+
+// rename a tag
+func (app *application) updateTag(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	var payload TagPayload
+	err = app.readJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, errors.New("invalid json request"))
+		return
+	}
+
+	v := app.validateTag(payload)
+	if !v.Valid() {
+		app.writeJSON(w, http.StatusBadRequest, v)
+		return
+	}
+
+	tag, err := app.models.Db.UpdateTag(id, payload.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.errorJSON(w, errors.New("tag not found"), http.StatusNotFound)
+		case errors.Is(err, models.ErrDuplicateTag):
+			app.errorJSON(w, err, http.StatusConflict)
+		default:
+			app.logger.Println(err)
+			app.errorJSON(w, errors.New("failed to update the tag"), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, tag, "tag")
+}
+
+// delete a tag
+func (app *application) deleteTag(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	err = app.models.Db.DeleteTag(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("tag not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, errors.New("failed to delete the tag"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{OK: true, Message: "tag deleted successfully"})
+}
+
+// replace the tags of a movie
+func (app *application) setMovieTags(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid id parameter"))
+		return
+	}
+
+	var payload MovieTagsPayload
+	err = app.readJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, errors.New("invalid json request"))
+		return
+	}
+
+	err = app.models.Db.SetMovieTags(id, payload.TagIDs)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("movie not found"), http.StatusNotFound)
+			return
+		}
+		app.logger.Println(err)
+		app.errorJSON(w, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{OK: true, Message: "movie tags updated successfully"})
+}
@@ -25,17 +25,27 @@ func (m *DbModel) InsertUser(name, email, password string) error {
 
 // GetUserByEmail gets user by email
 func (m *DbModel) GetUserByEmail(email string) (*User, error) {
-	stmt := `SELECT id, name, email, password, user_type FROM users
+	stmt := `SELECT id, name, email, password, user_type, suspended FROM users
 	WHERE email = $1`
 
 	row := m.Db.QueryRow(stmt, email)
 
 	u := &User{}
 
-	err := row.Scan(&u.ID, &u.FullName, &u.Email, &u.Password, &u.UserType)
+	err := row.Scan(&u.ID, &u.FullName, &u.Email, &u.Password, &u.UserType, &u.Suspended)
 	if err != nil {
 		return nil, err
 	}
 
 	return u, nil
-}
\ No newline at end of file
+}
+
+// IsUserSuspended reports whether the user is suspended, it returns sql.ErrNoRows when the user does not exist
+func (m *DbModel) IsUserSuspended(id int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var suspended bool
+	err := m.Db.QueryRowContext(ctx, `SELECT suspended FROM users WHERE id = $1`, id).Scan(&suspended)
+	return suspended, err
+}
@@ -0,0 +1,302 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The methods of this file load data for many movies or users at once, they back
+// the batching resolvers of the graphql endpoint so a query costs one sql query
+// per level of nesting instead of one per movie.
+
+// GetMoviesByIDs returns the movies with the given ids in the order of ids, unknown ids are left out
+func (m *DbModel) GetMoviesByIDs(ids []int, opts MovieOptions) ([]*Movie, error) {
+	if len(ids) == 0 {
+		return []*Movie{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT m.id, m.title, ` + opts.Fields.column("description", "m.description", "''") + `, m.year, m.release_date, m.runtime, m.image, m.created_at, m.updated_at,
+		TRUNC(AVG(r.rating)::numeric, 1) AS rating,
+		COUNT(DISTINCT r.id) AS rating_count,
+		COUNT(DISTINCT f.id) AS favorites_count,
+		(SELECT COUNT(*) FROM comments c WHERE c.movie_id = m.id AND c.deleted_at IS NULL AND c.status = 'published') AS comments_count
+	FROM movies m
+	LEFT JOIN ratings r ON r.movie_id = m.id
+	LEFT JOIN favorites f ON f.movie_id = m.id
+	WHERE m.id = ANY($1)
+	GROUP BY m.id`
+
+	rows, err := m.Db.QueryContext(ctx, query, pq.Array(int64s(ids)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int]*Movie, len(ids))
+	var loaded []*Movie
+	for rows.Next() {
+		var movie Movie
+		var image sql.NullString
+		err := rows.Scan(
+			&movie.ID,
+			&movie.Title,
+			&movie.Description,
+			&movie.Year,
+			&movie.ReleaseDate,
+			&movie.Runtime,
+			&image,
+			&movie.CreatedAt,
+			&movie.UpdatedAt,
+			&movie.Rating,
+			&movie.RatingCount,
+			&movie.TotalFavorites,
+			&movie.TotalComments,
+		)
+		if err != nil {
+			return nil, err
+		}
+		movie.Image = imageURL(image)
+		byID[movie.ID] = &movie
+		loaded = append(loaded, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = m.attachRelations(ctx, loaded, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	movies := make([]*Movie, 0, len(loaded))
+	for _, id := range ids {
+		if movie, ok := byID[id]; ok {
+			movies = append(movies, movie)
+		}
+	}
+
+	return movies, nil
+}
+
+// GetMovieIDs returns a page of movie ids in id order, limited to the movies of a genre unless genreID is 0
+func (m *DbModel) GetMovieIDs(genreID, limit, offset int) ([]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT m.id
+	FROM movies m
+	WHERE $1 = 0 OR m.id IN (SELECT mg.movie_id FROM movies_genres mg WHERE mg.genre_id = $1)
+	ORDER BY m.id
+	LIMIT $2 OFFSET $3`
+
+	rows, err := m.Db.QueryContext(ctx, query, genreID, limitArg(limit), offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// LoadGenres sets the genres of all the given movies
+func (m *DbModel) LoadGenres(movies []*Movie) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.attachGenres(ctx, movies)
+}
+
+// LoadTags sets the tags of all the given movies
+func (m *DbModel) LoadTags(movies []*Movie) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.attachTags(ctx, movies)
+}
+
+// GetCommentsByMovieIDs returns the comments of the given movies grouped by movie, most recent first.
+// limit applies to each movie, 0 returns every comment.
+func (m *DbModel) GetCommentsByMovieIDs(ids []int, limit int) (map[int][]Comment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + commentColumns + `
+	FROM (
+		SELECT c.*, ROW_NUMBER() OVER (PARTITION BY c.movie_id ORDER BY c.created_at DESC, c.id DESC) AS position
+		FROM comments c
+		WHERE c.movie_id = ANY($1) AND c.status = 'published'
+	) c
+	LEFT JOIN users u ON (u.id = c.user_id)
+	WHERE $2::int IS NULL OR c.position <= $2
+	ORDER BY c.movie_id, c.position`
+
+	rows, err := m.Db.QueryContext(ctx, query, pq.Array(int64s(ids)), limitArg(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := make(map[int][]Comment, len(ids))
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments[comment.MovieID] = append(comments[comment.MovieID], *comment)
+	}
+
+	return comments, rows.Err()
+}
+
+// GetRatingsByMovieIDs returns the ratings of the given movies grouped by movie, most recent first.
+// limit applies to each movie, 0 returns every rating.
+func (m *DbModel) GetRatingsByMovieIDs(ids []int, limit int) (map[int][]Rating, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT id, movie_id, user_id, rating, created_at, updated_at
+	FROM (
+		SELECT r.*, ROW_NUMBER() OVER (PARTITION BY r.movie_id ORDER BY r.updated_at DESC, r.id DESC) AS position
+		FROM ratings r
+		WHERE r.movie_id = ANY($1)
+	) ranked
+	WHERE $2::int IS NULL OR position <= $2
+	ORDER BY movie_id, position`
+
+	rows, err := m.Db.QueryContext(ctx, query, pq.Array(int64s(ids)), limitArg(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ratings := make(map[int][]Rating, len(ids))
+	for rows.Next() {
+		var rating Rating
+		err := rows.Scan(&rating.ID, &rating.MovieID, &rating.UserID, &rating.Rating, &rating.CreatedAt, &rating.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		ratings[rating.MovieID] = append(ratings[rating.MovieID], rating)
+	}
+
+	return ratings, rows.Err()
+}
+
+// GetFavoritesByMovieIDs returns the favorites of the given movies grouped by movie, most recent first.
+// limit applies to each movie, 0 returns every favorite.
+func (m *DbModel) GetFavoritesByMovieIDs(ids []int, limit int) (map[int][]Favorite, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT id, user_id, movie_id, created_at, updated_at
+	FROM (
+		SELECT f.*, ROW_NUMBER() OVER (PARTITION BY f.movie_id ORDER BY f.updated_at DESC, f.id DESC) AS position
+		FROM favorites f
+		WHERE f.movie_id = ANY($1)
+	) ranked
+	WHERE $2::int IS NULL OR position <= $2
+	ORDER BY movie_id, position`
+
+	rows, err := m.Db.QueryContext(ctx, query, pq.Array(int64s(ids)), limitArg(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	favorites := make(map[int][]Favorite, len(ids))
+	for rows.Next() {
+		var favorite Favorite
+		err := rows.Scan(&favorite.ID, &favorite.UserID, &favorite.MovieID, &favorite.CreatedAt, &favorite.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		favorites[favorite.MovieID] = append(favorites[favorite.MovieID], favorite)
+	}
+
+	return favorites, rows.Err()
+}
+
+// GetSimilarMovieIDs returns, for each of the given movies, the ids of the movies sharing
+// the most genres with it. limit applies to each movie.
+func (m *DbModel) GetSimilarMovieIDs(ids []int, limit int) (map[int][]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT movie_id, similar_id
+	FROM (
+		SELECT a.movie_id, b.movie_id AS similar_id,
+			ROW_NUMBER() OVER (PARTITION BY a.movie_id ORDER BY COUNT(*) DESC, b.movie_id) AS position
+		FROM movies_genres a
+		JOIN movies_genres b ON (b.genre_id = a.genre_id AND b.movie_id <> a.movie_id)
+		WHERE a.movie_id = ANY($1)
+		GROUP BY a.movie_id, b.movie_id
+	) ranked
+	WHERE $2::int IS NULL OR position <= $2
+	ORDER BY movie_id, position`
+
+	rows, err := m.Db.QueryContext(ctx, query, pq.Array(int64s(ids)), limitArg(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	similar := make(map[int][]int, len(ids))
+	for rows.Next() {
+		var movieID, similarID int
+		err := rows.Scan(&movieID, &similarID)
+		if err != nil {
+			return nil, err
+		}
+		similar[movieID] = append(similar[movieID], similarID)
+	}
+
+	return similar, rows.Err()
+}
+
+// GetUsersByIDs returns the public profile of the given users, keyed by id
+func (m *DbModel) GetUsersByIDs(ids []int) (map[int]*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.Db.QueryContext(ctx, `SELECT id, name, created_at FROM users WHERE id = ANY($1)`, pq.Array(int64s(ids)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make(map[int]*User, len(ids))
+	for rows.Next() {
+		var user User
+		err := rows.Scan(&user.ID, &user.FullName, &user.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		users[user.ID] = &user
+	}
+
+	return users, rows.Err()
+}
+
+// int64s converts ids for pq.Array
+func int64s(ids []int) []int64 {
+	values := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, int64(id))
+	}
+	return values
+}
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/priyanshu-gupta07/MovieFlix-backend/cache"
+)
+
+// how long the DbModel reads stay in the cache, writes invalidate them earlier
+const (
+	genresTTL = 10 * time.Minute
+	latestTTL = time.Minute
+	movieTTL  = 5 * time.Minute
+)
+
+// cached returns the value stored in the cache under key, or calls load and caches its result.
+// Values are stored as json, so only what is served to the clients survives the cache.
+func cached[T any](m *DbModel, key string, ttl time.Duration, load func() (T, error)) (T, error) {
+	if m.Cache == nil {
+		return load()
+	}
+
+	if data, ok := m.Cache.Get(key); ok {
+		var value T
+		if err := json.Unmarshal(data, &value); err == nil {
+			return value, nil
+		}
+		m.Cache.Delete(key)
+	}
+
+	// a write invalidating the key while load runs makes the loaded value stale, it's not stored then
+	gen := m.gens.of(key)
+
+	value, err := load()
+	if err != nil {
+		return value, err
+	}
+
+	if data, err := json.Marshal(value); err == nil {
+		m.gens.setIfCurrent(m.Cache, key, gen, data, ttl)
+	}
+
+	return value, nil
+}
+
+// invalidateMovie drops the cached reads showing the movie
+func (m *DbModel) invalidateMovie(id int) {
+	if m.Cache == nil {
+		return
+	}
+	m.gens.invalidate(m.Cache, fmt.Sprintf("movie:%d:", id), "movies:")
+}
+
+// invalidateCatalog drops every cached read, used when genres or tags shared by many movies change
+func (m *DbModel) invalidateCatalog() {
+	if m.Cache == nil {
+		return
+	}
+	m.gens.invalidate(m.Cache, "genres:", "movie:", "movies:")
+}
+
+// generations counts the invalidations of every key prefix, the prefixes end with a ':'.
+// A nil *generations counts nothing and stores every value.
+type generations struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+func newGenerations() *generations {
+	return &generations{counts: make(map[string]uint64)}
+}
+
+// of returns the generation of a key, the sum of the counters of the prefixes it starts with
+func (g *generations) of(key string) uint64 {
+	if g == nil {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.current(key)
+}
+
+// current is of with the lock held
+func (g *generations) current(key string) uint64 {
+	var gen uint64
+	for i := 0; i < len(key); i++ {
+		if key[i] == ':' {
+			gen += g.counts[key[:i+1]]
+		}
+	}
+	return gen
+}
+
+// setIfCurrent stores value under key unless the key was invalidated since its generation was read.
+// The check and the store share the lock of invalidate, so an invalidation can't slip in between.
+func (g *generations) setIfCurrent(c cache.Cache, key string, gen uint64, value []byte, ttl time.Duration) {
+	if g == nil {
+		c.Set(key, value, ttl)
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.current(key) == gen {
+		c.Set(key, value, ttl)
+	}
+}
+
+// invalidate moves the generation of the prefixes forward and drops their keys
+func (g *generations) invalidate(c cache.Cache, prefixes ...string) {
+	if g != nil {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		for _, prefix := range prefixes {
+			g.counts[prefix]++
+		}
+	}
+	for _, prefix := range prefixes {
+		c.DeletePrefix(prefix)
+	}
+}
+
+// key returns a stable representation of the field set to build cache keys
+func (f FieldSet) key() string {
+	if f == nil {
+		return "*"
+	}
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// idsKey returns a short stable representation of a list of ids to build cache keys
+func idsKey(ids []int) string {
+	h := fnv.New64a()
+	for _, id := range ids {
+		fmt.Fprintf(h, "%d,", id)
+	}
+	return fmt.Sprintf("%d-%x", len(ids), h.Sum64())
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/priyanshu-gupta07/MovieFlix-backend/cache"
+)
+
+func TestCachedSkipsStaleValues(t *testing.T) {
+	m := &DbModel{Cache: cache.NewLRU(10), gens: newGenerations()}
+
+	// a write lands while the read is loading the old value
+	value, err := cached(m, "movie:1:detail", time.Minute, func() (string, error) {
+		m.invalidateMovie(1)
+		return "old", nil
+	})
+	if err != nil || value != "old" {
+		t.Fatalf("cached() = %q, %v, want old", value, err)
+	}
+	if _, ok := m.Cache.Get("movie:1:detail"); ok {
+		t.Errorf("the value loaded before the invalidation was cached")
+	}
+
+	// another movie or the whole catalog moving doesn't matter once the load is over
+	value, _ = cached(m, "movie:1:detail", time.Minute, func() (string, error) {
+		m.invalidateMovie(2)
+		return "new", nil
+	})
+	if value != "new" {
+		t.Fatalf("cached() = %q, want new", value)
+	}
+	if _, ok := m.Cache.Get("movie:1:detail"); !ok {
+		t.Errorf("the value was not cached although the movie didn't change")
+	}
+
+	value, _ = cached(m, "movie:1:detail", time.Minute, func() (string, error) {
+		t.Errorf("cached() loaded a cached value")
+		return "", nil
+	})
+	if value != "new" {
+		t.Errorf("cached() = %q, want the cached new", value)
+	}
+
+	m.Cache.Delete("movie:1:detail")
+	cached(m, "movie:1:detail", time.Minute, func() (string, error) {
+		m.invalidateCatalog()
+		return "old", nil
+	})
+	if _, ok := m.Cache.Get("movie:1:detail"); ok {
+		t.Errorf("the value loaded before the catalog invalidation was cached")
+	}
+}
+
+func TestGenerationsOf(t *testing.T) {
+	g := newGenerations()
+	g.counts["movie:"] = 1
+	g.counts["movie:1:"] = 2
+	g.counts["movie:12:"] = 4
+
+	tests := []struct {
+		key  string
+		want uint64
+	}{
+		{"movie:1:detail", 3},
+		{"movie:12:detail", 5},
+		{"movies:latest", 0},
+		{"genres", 0},
+	}
+
+	for _, tt := range tests {
+		if got := g.of(tt.key); got != tt.want {
+			t.Errorf("of(%q) = %d, want %d", tt.key, got, tt.want)
+		}
+	}
+
+	var nilGens *generations
+	if got := nilGens.of("movie:1:detail"); got != 0 {
+		t.Errorf("of() on nil generations = %d, want 0", got)
+	}
+}
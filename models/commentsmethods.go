@@ -0,0 +1,475 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// commentColumns selects a comment of the c alias, with its author from the u alias, in the order scanComment
+// reads them. The text and author of a deleted comment are replaced by the placeholder.
+const commentColumns = `c.id, c.movie_id, c.user_id,
+	CASE WHEN c.deleted_at IS NULL THEN COALESCE(u.name, '') ELSE '' END,
+	c.parent_id, c.depth,
+	(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id AND r.status = 'published') AS reply_count,
+	CASE WHEN c.deleted_at IS NULL THEN c.comment ELSE '[deleted]' END,
+	c.status, c.deleted_at IS NOT NULL,
+	c.created_at, c.updated_at`
+
+func scanComment(row rowScanner) (*Comment, error) {
+	var comment Comment
+	err := row.Scan(
+		&comment.ID,
+		&comment.MovieID,
+		&comment.UserID,
+		&comment.UserName,
+		&comment.ParentID,
+		&comment.Depth,
+		&comment.ReplyCount,
+		&comment.Comment,
+		&comment.Status,
+		&comment.Deleted,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// GetComment returns a comment with the name of its author, deleted placeholders included
+func (m *DbModel) GetComment(id int) (*Comment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + commentColumns + `
+	FROM comments c
+	LEFT JOIN users u ON (u.id = c.user_id)
+	WHERE c.id = $1`
+
+	return scanComment(m.Db.QueryRowContext(ctx, query, id))
+}
+
+// GetCommentReplies returns a page of the direct replies to a comment, oldest first, with the reactions
+// of userID when it's not 0. It returns sql.ErrNoRows when the comment does not exist or is not shown,
+// only published comments and the placeholders of deleted ones list their replies.
+func (m *DbModel) GetCommentReplies(id, page, perPage, userID int) (*PaginatedComments, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result := &PaginatedComments{PerPage: perPage, CurrentPage: page, Comments: []Comment{}}
+
+	query := `SELECT (SELECT COUNT(*) FROM comments WHERE parent_id = p.id AND status = 'published') FROM comments p
+	WHERE p.id = $1 AND (p.status = 'published' OR p.deleted_at IS NOT NULL)`
+	err := m.Db.QueryRowContext(ctx, query, id).Scan(&result.TotalCount)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `SELECT ` + commentColumns + `
+	FROM comments c
+	LEFT JOIN users u ON (u.id = c.user_id)
+	WHERE c.parent_id = $1 AND c.status = 'published'
+	ORDER BY c.created_at, c.id
+	LIMIT $2 OFFSET $3`
+
+	rows, err := m.Db.QueryContext(ctx, query, id, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		result.Comments = append(result.Comments, *comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = m.attachReactionCounts(ctx, result.Comments)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.loadMyReactions(result.Comments, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// InsertComment saves a new comment, or a reply when ParentID is set, and sets its id.
+// It returns sql.ErrNoRows when the movie does not exist.
+func (m *DbModel) InsertComment(comment *Comment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO comments (movie_id, user_id, parent_id, depth, comment, status, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id`
+
+	err := m.Db.QueryRowContext(ctx, query,
+		comment.MovieID, comment.UserID, comment.ParentID, comment.Depth, comment.Comment, comment.Status, comment.CreatedAt, comment.UpdatedAt,
+	).Scan(&comment.ID)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return sql.ErrNoRows
+		}
+		return err
+	}
+
+	m.invalidateMovie(comment.MovieID)
+
+	return nil
+}
+
+// UpdateComment saves the text and status of a comment, created_at is left as it is
+func (m *DbModel) UpdateComment(comment *Comment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE comments SET comment = $1, status = $2, updated_at = $3 WHERE id = $4 AND deleted_at IS NULL RETURNING movie_id`
+
+	err := m.Db.QueryRowContext(ctx, query, comment.Comment, comment.Status, comment.UpdatedAt, comment.ID).Scan(&comment.MovieID)
+	if err != nil {
+		return err
+	}
+
+	m.invalidateMovie(comment.MovieID)
+
+	return nil
+}
+
+// DeleteComment deletes a comment. A comment with replies is kept as a "[deleted]" placeholder so the
+// thread stays readable, and placeholders left without replies are removed up the thread.
+func (m *DbModel) DeleteComment(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var movieID int
+	var parentID sql.NullInt64
+	var hasReplies bool
+	query := `SELECT movie_id, parent_id, EXISTS(SELECT 1 FROM comments r WHERE r.parent_id = c.id)
+	FROM comments c WHERE c.id = $1 AND c.deleted_at IS NULL FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, id).Scan(&movieID, &parentID, &hasReplies)
+	if err != nil {
+		return err
+	}
+
+	if hasReplies {
+		now := time.Now()
+		_, err = tx.ExecContext(ctx, `UPDATE comments SET comment = '', deleted_at = $1, updated_at = $1 WHERE id = $2`, now, id)
+		if err != nil {
+			return err
+		}
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM comments WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+
+		for parentID.Valid {
+			query := `DELETE FROM comments p
+			WHERE p.id = $1 AND p.deleted_at IS NOT NULL AND NOT EXISTS(SELECT 1 FROM comments r WHERE r.parent_id = p.id)
+			RETURNING p.parent_id`
+			err = tx.QueryRowContext(ctx, query, parentID.Int64).Scan(&parentID)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					break
+				}
+				return err
+			}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	m.invalidateMovie(movieID)
+
+	return nil
+}
+
+// CommentReactions are the reactions a user can leave on a comment
+var CommentReactions = []string{"like", "love", "laugh", "wow", "sad", "angry"}
+
+// SetCommentReaction sets the reaction of a user on a comment, replacing the previous one.
+// It returns sql.ErrNoRows when the comment does not exist.
+func (m *DbModel) SetCommentReaction(commentID, userID int, reaction string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO comment_reactions (comment_id, user_id, reaction, created_at, updated_at)
+	SELECT c.id, $2, $3, $4, $4 FROM comments c WHERE c.id = $1 AND c.deleted_at IS NULL AND c.status = 'published'
+	ON CONFLICT (comment_id, user_id) DO UPDATE SET reaction = excluded.reaction, updated_at = excluded.updated_at
+	RETURNING (SELECT movie_id FROM comments WHERE id = $1)`
+
+	var movieID int
+	err := m.Db.QueryRowContext(ctx, query, commentID, userID, reaction, time.Now()).Scan(&movieID)
+	if err != nil {
+		return err
+	}
+
+	m.invalidateMovie(movieID)
+
+	return nil
+}
+
+// DeleteCommentReaction clears the reaction of a user on a comment, sql.ErrNoRows when there is none
+func (m *DbModel) DeleteCommentReaction(commentID, userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `DELETE FROM comment_reactions WHERE comment_id = $1 AND user_id = $2
+	RETURNING (SELECT movie_id FROM comments WHERE id = $1)`
+
+	var movieID int
+	err := m.Db.QueryRowContext(ctx, query, commentID, userID).Scan(&movieID)
+	if err != nil {
+		return err
+	}
+
+	m.invalidateMovie(movieID)
+
+	return nil
+}
+
+// attachReactionCounts sets the reaction counts of all the comments with a single query
+func (m *DbModel) attachReactionCounts(ctx context.Context, comments []Comment) error {
+	if len(comments) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(comments))
+	byID := make(map[int]*Comment, len(comments))
+	for i := range comments {
+		comments[i].Reactions = map[string]int{}
+		ids = append(ids, int64(comments[i].ID))
+		byID[comments[i].ID] = &comments[i]
+	}
+
+	query := `SELECT comment_id, reaction, COUNT(*) FROM comment_reactions WHERE comment_id = ANY($1) GROUP BY comment_id, reaction`
+
+	rows, err := m.Db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var commentID, count int
+		var reaction string
+		err := rows.Scan(&commentID, &reaction, &count)
+		if err != nil {
+			return err
+		}
+		byID[commentID].Reactions[reaction] = count
+	}
+
+	return rows.Err()
+}
+
+// loadMyReactions sets the reaction of userID on all the comments with a single query, anonymous requests are skipped
+func (m *DbModel) loadMyReactions(comments []Comment, userID int) error {
+	if userID == 0 || len(comments) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	ids := make([]int64, 0, len(comments))
+	byID := make(map[int]*Comment, len(comments))
+	for i := range comments {
+		ids = append(ids, int64(comments[i].ID))
+		byID[comments[i].ID] = &comments[i]
+	}
+
+	query := `SELECT comment_id, reaction FROM comment_reactions WHERE user_id = $1 AND comment_id = ANY($2)`
+
+	rows, err := m.Db.QueryContext(ctx, query, userID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var commentID int
+		var reaction string
+		err := rows.Scan(&commentID, &reaction)
+		if err != nil {
+			return err
+		}
+		byID[commentID].MyReaction = &reaction
+	}
+
+	return rows.Err()
+}
+
+// DefaultCommentsLimit is the size of a page of comments when the client doesn't ask for one
+const DefaultCommentsLimit = 20
+
+// ErrInvalidCursor is returned when a comment cursor can't be decoded or was made for another sort
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// commentCursor is the position of the last comment of a page, sent to the clients as opaque base64
+type commentCursor struct {
+	Sort      string    `json:"o"`
+	CreatedAt time.Time `json:"t"`
+	ID        int       `json:"id"`
+	Score     int       `json:"s,omitempty"`
+}
+
+func (c commentCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCommentCursor(s, sort string) (commentCursor, error) {
+	var c commentCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	err = json.Unmarshal(data, &c)
+	if err != nil || c.Sort != sort {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// scoreScanner reads the columns of a row after the ones scanned by the wrapped scanner
+type scoreScanner struct {
+	rowScanner
+	extra []interface{}
+}
+
+func (s scoreScanner) Scan(dest ...interface{}) error {
+	return s.rowScanner.Scan(append(dest, s.extra...)...)
+}
+
+// GetMovieComments returns a page of the top level comments of a movie with their reaction counts, and the
+// reaction of userID when it's not 0. It returns sql.ErrNoRows when the movie does not exist and
+// ErrInvalidCursor for a bad cursor.
+func (m *DbModel) GetMovieComments(movieID int, page CommentPage, userID int) (*CommentList, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	exists, err := m.movieExists(ctx, movieID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+
+	comments, next, err := m.movieComments(ctx, movieID, page)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.attachReactionCounts(ctx, comments)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.loadMyReactions(comments, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &CommentList{Comments: comments}
+	if next != "" {
+		list.NextCursor = &next
+	}
+
+	return list, nil
+}
+
+// movieComments returns a page of the top level comments of a movie using keyset pagination, and the cursor
+// of the next page, empty on the last one
+func (m *DbModel) movieComments(ctx context.Context, movieID int, page CommentPage) ([]Comment, string, error) {
+	limit := page.Limit
+	if limit <= 0 {
+		limit = DefaultCommentsLimit
+	}
+
+	var order, after string
+	switch page.Sort {
+	case "oldest":
+		order, after = `c.created_at, c.id`, `(c.created_at, c.id) > ($3::timestamp, $4)`
+	case "top":
+		order, after = `c.score DESC, c.id DESC`, `(c.score, c.id) < ($3, $4)`
+	default:
+		page.Sort = "newest"
+		order, after = `c.created_at DESC, c.id DESC`, `(c.created_at, c.id) < ($3::timestamp, $4)`
+	}
+
+	// one more row than asked tells whether there is a next page
+	args := []interface{}{movieID, limit + 1}
+	where := `TRUE`
+	if page.Cursor != "" {
+		cursor, err := decodeCommentCursor(page.Cursor, page.Sort)
+		if err != nil {
+			return nil, "", err
+		}
+		if page.Sort == "top" {
+			args = append(args, cursor.Score, cursor.ID)
+		} else {
+			args = append(args, cursor.CreatedAt, cursor.ID)
+		}
+		where = after
+	}
+
+	query := `SELECT ` + commentColumns + `, c.score
+	FROM (
+		SELECT c.*, (SELECT COUNT(*) FROM comment_reactions cr WHERE cr.comment_id = c.id) AS score
+		FROM comments c
+		WHERE c.movie_id = $1 AND c.parent_id IS NULL AND c.status = 'published'
+	) c
+	LEFT JOIN users u ON (u.id = c.user_id)
+	WHERE ` + where + `
+	ORDER BY ` + order + `
+	LIMIT $2`
+
+	rows, err := m.Db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	var last commentCursor
+	for rows.Next() {
+		var score int
+		comment, err := scanComment(scoreScanner{rows, []interface{}{&score}})
+		if err != nil {
+			return nil, "", err
+		}
+		if len(comments) == limit {
+			return comments, last.encode(), rows.Err()
+		}
+		comments = append(comments, *comment)
+		last = commentCursor{Sort: page.Sort, CreatedAt: comment.CreatedAt, ID: comment.ID, Score: score}
+	}
+
+	return comments, "", rows.Err()
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+)
+
+// FieldSet is the set of json fields a client asked for with ?fields=, a nil set means every field
+type FieldSet map[string]bool
+
+// Has reports whether field has to be loaded
+func (f FieldSet) Has(field string) bool {
+	return f == nil || f[field]
+}
+
+// column returns the sql expression of a field when it is requested, zero otherwise,
+// so the columns of a query keep the same order whatever the client asked for
+func (f FieldSet) column(field, expr, zero string) string {
+	if f.Has(field) {
+		return expr
+	}
+	return zero + " AS " + field
+}
+
+// movieFields are the json names of the Movie fields
+var movieFields = jsonFields(reflect.TypeOf(Movie{}))
+
+// IsMovieField reports whether name is a field of the movie responses
+func IsMovieField(name string) bool {
+	return movieFields[name]
+}
+
+// jsonFields returns the json names of the exported fields of a struct type
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = true
+	}
+	return fields
+}
@@ -2,25 +2,30 @@ package models
 
 import (
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/cloudinary/cloudinary-go/v2"
+	"github.com/lib/pq"
+	"github.com/priyanshu-gupta07/MovieFlix-backend/cache"
 )
 
-//databse structure
+// databse structure
 type DbModel struct {
-	Db *sql.DB
+	Db    *sql.DB
+	Cache cache.Cache // nil disables caching
+	gens  *generations
 }
 
-//model structure- Wrapper Class for Database
+// model structure- Wrapper Class for Database
 type Model struct {
-	Db DbModel
+	Db  DbModel
 	Cld *cloudinary.Cloudinary
 }
 
-func CreateModel(db *sql.DB, cld *cloudinary.Cloudinary) Model {
+func CreateModel(db *sql.DB, cld *cloudinary.Cloudinary, c cache.Cache) Model {
 	return Model{
-		Db: DbModel{Db: db},
+		Db:  DbModel{Db: db, Cache: c, gens: newGenerations()},
 		Cld: cld,
 	}
 }
@@ -33,23 +38,93 @@ type Movie struct {
 	Year           int            `json:"year"`
 	ReleaseDate    time.Time      `json:"release_date"`
 	Runtime        int            `json:"runtime"`
-	Rating         float64        `json:"rating"`
-	Ratings        []Rating       `json:"ratings,omitempty"` // this is for movie details
-	TotalFavorites int            `json:"total_favorites"`   // this is for movie details
+	Rating         *float64       `json:"rating"` // null when the movie has no votes
+	RatingCount    int            `json:"rating_count"`
+	WeightedRating float64        `json:"weighted_rating,omitempty"` // this is for top rated chart
+	Ratings        []Rating       `json:"ratings,omitempty"`         // this is for movie details
+	RatingSummary  *RatingSummary `json:"rating_summary,omitempty"`  // this is for movie details
+	TotalFavorites int            `json:"total_favorites"`           // this is for movie details
 	IsFavorite     bool           `json:"is_favorite"`
+	MyRating       *float64       `json:"my_rating"` // null for anonymous requests and unrated movies
+	InWatchlist    bool           `json:"in_watchlist"`
+	RatedAt        *time.Time     `json:"rated_at,omitempty"` // this is for the rating history of a user
 	Favorites      []Favorite     `json:"favorites,omitempty"`
 	TotalComments  int            `json:"total_comments"`
-	Comments       []Comment      `json:"comments,omitempty"` // this is for movie details
-	MovieGenre     map[int]string `json:"genres"`             // this is for movie details
+	Comments       []Comment      `json:"comments,omitempty"`        // this is for movie details, the first page of the top level comments
+	CommentsCursor string         `json:"comments_cursor,omitempty"` // the cursor of the next page of comments
+	MovieGenre     map[int]string `json:"genres"`                    // this is for movie details
+	Tags           []Tag          `json:"tags"`
 	Image          string         `json:"image"`
 	CreatedAt      time.Time      `json:"-"`
 	UpdatedAt      time.Time      `json:"-"`
 }
 
+// MovieOptions tunes what the movie read methods load
+type MovieOptions struct {
+	Fields FieldSet // nil loads every field
+	UserID int      // the user the is_favorite, my_rating and in_watchlist flags are set for, 0 when anonymous
+}
+
+// MovieInclude selects the relations GetMovie loads, a limit of 0 loads every row
+// except for comments, which are paginated and default to DefaultCommentsLimit
+type MovieInclude struct {
+	Genres         bool
+	Tags           bool
+	Comments       bool
+	CommentsLimit  int
+	Ratings        bool
+	RatingsLimit   int
+	Favorites      bool
+	FavoritesLimit int
+	RatingSummary  bool
+}
+
+// DefaultMovieInclude is what GetMovie loads when the client doesn't ask for specific relations
+func DefaultMovieInclude() MovieInclude {
+	return MovieInclude{Genres: true, Tags: true, Comments: true, RatingSummary: true}
+}
+
 // Genre is the type for genre table
 type Genre struct {
+	ID         int       `json:"id"`
+	GenreName  string    `json:"genre_name"`
+	ParentID   *int      `json:"parent_id"`
+	MovieCount int       `json:"movie_count"`
+	Children   []*Genre  `json:"children,omitempty"` // sub-genres, only set when building the tree
+	CreatedAt  time.Time `json:"-"`
+	UpdatedAt  time.Time `json:"-"`
+}
+
+// GenreStats holds the catalog numbers of a genre for the editorial dashboard
+type GenreStats struct {
+	GenreID        int           `json:"genre_id"`
+	GenreName      string        `json:"genre_name"`
+	MovieCount     int           `json:"movie_count"`
+	RatingCount    int           `json:"rating_count"`
+	AverageRating  *float64      `json:"average_rating"`
+	TotalFavorites int           `json:"total_favorites"`
+	TotalComments  int           `json:"total_comments"`
+	NewestRelease  *GenreRelease `json:"newest_release"`
+}
+
+// GenreRelease is the most recently released movie of a genre
+type GenreRelease struct {
+	MovieID     int       `json:"movie_id"`
+	Title       string    `json:"title"`
+	ReleaseDate time.Time `json:"release_date"`
+}
+
+// ErrDuplicateGenre is returned when a genre with the same name, ignoring case, already exists
+var ErrDuplicateGenre = errors.New("genre already exists")
+
+// ErrGenreCycle is returned when a genre would become its own ancestor
+var ErrGenreCycle = errors.New("a genre can't be nested under itself or one of its sub-genres")
+
+// Tag is the type for tags table, tags are free-form keywords like "time travel"
+type Tag struct {
 	ID        int       `json:"id"`
-	GenreName string    `json:"genre_name"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
 	CreatedAt time.Time `json:"-"`
 	UpdatedAt time.Time `json:"-"`
 }
@@ -89,15 +164,92 @@ type Rating struct {
 	UpdatedAt time.Time `json:"-"`
 }
 
+// RatingBucket is the number of votes a movie got for one rating value
+type RatingBucket struct {
+	Rating float64 `json:"rating"`
+	Count  int     `json:"count"`
+}
+
+// RatingSummary describes how the votes of a movie are spread
+type RatingSummary struct {
+	TotalVotes int            `json:"total_votes"`
+	Average    *float64       `json:"average"`
+	Median     *float64       `json:"median"`
+	StdDev     *float64       `json:"std_dev"`
+	Histogram  []RatingBucket `json:"histogram"`
+}
+
+// the publication status of comments and reviews, only published ones are listed
+const (
+	StatusPublished = "published"
+	StatusPending   = "pending" // held by the moderation filter until a moderator approves it
+	StatusHidden    = "hidden"  // hidden by a moderator after a report
+)
+
 // model for comment
 type Comment struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"user_id"`
-	UserName  string    `json:"user_name"`
-	MovieID   int       `json:"movie_id,omitempty"`
-	Comment   string    `json:"comment"`
-	CreatedAt time.Time `json:"-"`
-	UpdatedAt time.Time `json:"commented_at"`
+	ID         int            `json:"id"`
+	UserID     int            `json:"user_id"`
+	UserName   string         `json:"user_name"`
+	MovieID    int            `json:"movie_id,omitempty"`
+	ParentID   *int           `json:"parent_id"` // null for top level comments
+	Depth      int            `json:"depth"`     // 0 for top level comments, 1 for their replies and so on
+	ReplyCount int            `json:"reply_count"`
+	Comment    string         `json:"comment"`
+	Status     string         `json:"status"`
+	Deleted    bool           `json:"deleted,omitempty"` // a deleted comment with replies stays as a "[deleted]" placeholder
+	Reactions  map[string]int `json:"reactions,omitempty"`
+	MyReaction *string        `json:"my_reaction,omitempty"` // the reaction of the user reading the comment
+	CreatedAt  time.Time      `json:"commented_at"`
+	UpdatedAt  time.Time      `json:"updated_at"` // moves when the author edits the comment
+}
+
+// PaginatedComments is a page of the replies to a comment
+type PaginatedComments struct {
+	TotalCount  int       `json:"total_count"`
+	PerPage     int       `json:"per_page"`
+	CurrentPage int       `json:"current_page"`
+	Comments    []Comment `json:"comments"`
+}
+
+// CommentPage selects a page of the top level comments of a movie
+type CommentPage struct {
+	Sort   string // newest, oldest or top, the most reactions first
+	Cursor string // the next_cursor of the previous page, empty for the first page
+	Limit  int    // 0 uses DefaultCommentsLimit
+}
+
+// CommentList is a page of the top level comments of a movie
+type CommentList struct {
+	Comments   []Comment `json:"comments"`
+	NextCursor *string   `json:"next_cursor"` // null on the last page
+}
+
+// Review is a long-form review of a movie, one per user and movie
+type Review struct {
+	ID           int       `json:"id"`
+	MovieID      int       `json:"movie_id"`
+	UserID       int       `json:"user_id"`
+	UserName     string    `json:"user_name"`
+	Title        string    `json:"title"`
+	Body         string    `json:"body"`
+	Spoiler      bool      `json:"spoiler"`
+	Status       string    `json:"status"`
+	BodyHidden   bool      `json:"body_hidden,omitempty"` // the body of a spoiler is only sent when asked for
+	RatingID     *int      `json:"-"`
+	Rating       *float64  `json:"rating"` // the linked rating of the author, if any
+	HelpfulCount int       `json:"helpful_count"`
+	VotedHelpful bool      `json:"voted_helpful"` // whether the user reading the review voted it helpful
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// PaginatedReviews is a page of the reviews of a movie
+type PaginatedReviews struct {
+	TotalCount  int       `json:"total_count"`
+	PerPage     int       `json:"per_page"`
+	CurrentPage int       `json:"current_page"`
+	Reviews     []*Review `json:"reviews"`
 }
 
 // model for favorite
@@ -127,22 +279,118 @@ type User struct {
 	Email     string    `json:"email"`
 	UserType  string    `json:"user_type"`
 	Password  string    `json:"password,omitempty"`
+	Suspended bool      `json:"-"` // suspended users can't log in
 	CreatedAt time.Time `json:"-"`
 	UpdatedAt time.Time `json:"-"`
 }
 
-// Model for movies response
-type PaginatedMovies struct {
-	TotalCount  int      `json:"total_count"`
-	PerPage     int      `json:"per_page"`
-	CurrentPage int      `json:"current_page"`
-	Movies      []*Movie `json:"movies"`
+// Report is a complaint of a user about a comment, a review or another user
+type Report struct {
+	ID           int                `json:"id"`
+	ReporterID   int                `json:"reporter_id"`
+	ReporterName string             `json:"reporter_name"`
+	TargetType   string             `json:"target_type"` // comment, review or user
+	TargetID     int                `json:"target_id"`
+	Reason       string             `json:"reason"`
+	Details      string             `json:"details"`
+	Status       string             `json:"status"`            // open, triaged, resolved or dismissed
+	Actions      []ModerationAction `json:"actions,omitempty"` // this is for the report details
+	CreatedAt    time.Time          `json:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at"`
 }
 
+// ReportFilter narrows the moderation queue, empty fields match every report
+type ReportFilter struct {
+	Status     string
+	TargetType string
+}
 
+// PaginatedReports is a page of the moderation queue
+type PaginatedReports struct {
+	TotalCount  int       `json:"total_count"`
+	PerPage     int       `json:"per_page"`
+	CurrentPage int       `json:"current_page"`
+	Reports     []*Report `json:"reports"`
+}
 
+// ModerationAction is a decision of a moderator, on a report or directly on a user
+type ModerationAction struct {
+	ID            int       `json:"id"`
+	ReportID      *int      `json:"report_id"`
+	ModeratorID   int       `json:"moderator_id"`
+	ModeratorName string    `json:"moderator_name"`
+	Action        string    `json:"action"`
+	TargetType    string    `json:"target_type"`
+	TargetID      int       `json:"target_id"`
+	Note          string    `json:"note"`
+	CreatedAt     time.Time `json:"created_at"`
+}
 
+// PendingContent is a comment or review the moderation filter held back, waiting for a moderator
+type PendingContent struct {
+	TargetType string    `json:"target_type"` // comment or review
+	TargetID   int       `json:"target_id"`
+	MovieID    int       `json:"movie_id"`
+	UserID     int       `json:"user_id"`
+	UserName   string    `json:"user_name"`
+	Title      string    `json:"title"` // empty for comments
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+}
 
+// PaginatedPendingContent is a page of the content waiting for moderation
+type PaginatedPendingContent struct {
+	TotalCount  int               `json:"total_count"`
+	PerPage     int               `json:"per_page"`
+	CurrentPage int               `json:"current_page"`
+	Content     []*PendingContent `json:"content"`
+}
 
+// Notification is an entry of the inbox of a user
+type Notification struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"-"`
+	Type      string     `json:"type"`       // one of NotificationTypes
+	ActorID   *int       `json:"actor_id"`   // the user who caused the notification, if any
+	ActorName string     `json:"actor_name"` // empty without an actor
+	MovieID   *int       `json:"movie_id"`
+	CommentID *int       `json:"comment_id"`
+	Message   string     `json:"message"`
+	ReadAt    *time.Time `json:"read_at"` // null while unread
+	CreatedAt time.Time  `json:"created_at"`
+}
 
+// NotificationInbox is a page of the notifications of a user, most recent first
+type NotificationInbox struct {
+	UnreadCount   int             `json:"unread_count"`
+	TotalCount    int             `json:"total_count"`
+	PerPage       int             `json:"per_page"`
+	CurrentPage   int             `json:"current_page"`
+	Notifications []*Notification `json:"notifications"`
+}
+
+// NotificationPreference tells whether a user receives a type of notification
+type NotificationPreference struct {
+	Type    string `json:"type"`
+	Enabled bool   `json:"enabled"`
+}
+
+// Model for movies response
+type PaginatedMovies struct {
+	TotalCount  int      `json:"total_count"`
+	PerPage     int      `json:"per_page"`
+	CurrentPage int      `json:"current_page"`
+	Movies      []*Movie `json:"movies"`
+}
 
+// isUniqueViolation reports whether err is a postgres unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// isForeignKeyViolation reports whether err is a postgres foreign key violation
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
@@ -11,7 +11,7 @@ import (
 	"github.com/lib/pq"
 )
 
-func (m *DbModel) GetAllMovies() ([]*Movie, error) {
+func (m *DbModel) GetAllMovies(opts MovieOptions) ([]*Movie, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -19,10 +19,11 @@ func (m *DbModel) GetAllMovies() ([]*Movie, error) {
     SELECT 
         m.id, 
         m.title, 
-        m.description, 
+        ` + opts.Fields.column("description", "m.description", "''") + `, 
         m.year, 
         m.release_date, 
-        COALESCE(trunc(AVG(r.rating)::numeric, 1), 1.0) AS rating, 
+        trunc(AVG(r.rating)::numeric, 1) AS rating, 
+        COUNT(r.id) AS rating_count, 
         m.runtime, 
         m.created_at, 
         m.updated_at 
@@ -62,6 +63,7 @@ func (m *DbModel) GetAllMovies() ([]*Movie, error) {
 			&movie.Year,
 			&movie.ReleaseDate,
 			&movie.Rating,
+			&movie.RatingCount,
 			&movie.Runtime,
 			&movie.CreatedAt,
 			&movie.UpdatedAt,
@@ -70,43 +72,15 @@ func (m *DbModel) GetAllMovies() ([]*Movie, error) {
 			return nil, err
 		}
 		movie.Image = "https://res.cloudinary.com/dvc85iwpj/image/upload/v1720247654/download_i0205y.png"
-		movie.MovieGenre = make(map[int]string)
-
-		// get genres, if any
-		genreQuery := `SELECT
-                mg.id, mg.movie_id, mg.genre_id, g.genre_name
-            FROM
-                movies_genres mg
-                LEFT JOIN genres g ON (g.id = mg.genre_id)
-            WHERE
-                mg.movie_id = $1`
-
-		genreRows, err := m.Db.QueryContext(ctx, genreQuery, movie.ID)
-		if err != nil {
-			return nil, err
-		}
-
-		for genreRows.Next() {
-			var genreID int
-			var genreName string
-			err := genreRows.Scan(
-				new(int), // We don't need the id from movies_genres
-				new(int), // We don't need the movie_id
-				&genreID,
-				&genreName)
-
-			if err != nil {
-				genreRows.Close()
-				return nil, err
-			}
-
-			movie.MovieGenre[genreID] = genreName
-		}
-		genreRows.Close()
 
 		movies = append(movies, &movie)
 	}
 
+	err = m.attachRelations(ctx, movies, opts)
+	if err != nil {
+		return nil, err
+	}
+
 	return movies, nil
 }
 
@@ -132,44 +106,91 @@ func (m *DbModel) CheckGenre(Genreid int) (bool, error) {
 	return true, nil
 }
 
-func (m *DbModel) InsertGenre(Genrename string) (int, error) {
+func (m *DbModel) InsertGenre(Genrename string, parentID *int) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 
 	defer cancel()
 
-	query := `insert into genres (genre_name, created_at, updated_at) values ($1,$2,$3) returning id`
+	query := `insert into genres (genre_name, parent_id, created_at, updated_at) values ($1,$2,$3,$4) returning id`
 
 	var id int
 
-	err := m.Db.QueryRowContext(ctx, query, Genrename, time.Now(), time.Now()).Scan(&id)
+	err := m.Db.QueryRowContext(ctx, query, Genrename, parentID, time.Now(), time.Now()).Scan(&id)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, ErrDuplicateGenre
+		}
 		return 0, err
 	}
 
+	m.invalidateCatalog()
+
 	return id, nil
 }
 
-func (m *DbModel) UpdateGenre(id int, GenreName string) (int, error) {
+// UpdateGenre renames and moves a genre.
+// It returns sql.ErrNoRows when the genre does not exist.
+func (m *DbModel) UpdateGenre(id int, GenreName string, parentID *int) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 
 	defer cancel()
 
-	query := `update genres set genre_name = $1, updated_at = $2 where id = $3`
+	// a genre can't be moved under itself or one of its own sub-genres
+	if parentID != nil {
+		cycle, err := isGenreDescendant(ctx, m.Db, *parentID, id)
+		if err != nil {
+			return 0, err
+		}
+		if cycle {
+			return 0, ErrGenreCycle
+		}
+	}
+
+	query := `update genres set genre_name = $1, parent_id = $2, updated_at = $3 where id = $4`
+
+	result, err := m.Db.ExecContext(ctx, query, GenreName, parentID, time.Now(), id)
 
-	_, err := m.Db.ExecContext(ctx, query, GenreName, time.Now(), id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, ErrDuplicateGenre
+		}
+		return 0, err
+	}
 
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return 0, err
 	}
+	if rowsAffected == 0 {
+		return 0, sql.ErrNoRows
+	}
 
-	// rowsAffected,err := result.RowsAffected()
-	// if err!=nil {
-	// 	return 0,err
-	// }
+	m.invalidateCatalog()
 
 	return id, nil
 }
 
+// isGenreDescendant reports whether genreID is ancestorID itself or one of its sub-genres.
+// q is the transaction of the caller, if any, so the tree is read with its locks.
+func isGenreDescendant(ctx context.Context, q queryRower, genreID, ancestorID int) (bool, error) {
+	query := `WITH RECURSIVE genre_tree AS (
+		SELECT id FROM genres WHERE id = $1
+		UNION
+		SELECT g.id FROM genres g JOIN genre_tree gt ON (g.parent_id = gt.id)
+	)
+	SELECT EXISTS(SELECT 1 FROM genre_tree WHERE id = $2)`
+
+	var found bool
+	err := q.QueryRowContext(ctx, query, ancestorID, genreID).Scan(&found)
+	if err != nil {
+		return false, err
+	}
+
+	return found, nil
+}
+
+// DeleteGenre deletes a genre, its sub-genres become top level genres.
+// It returns sql.ErrNoRows when the genre does not exist.
 func (m *DbModel) DeleteGenre(id int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 
@@ -177,62 +198,158 @@ func (m *DbModel) DeleteGenre(id int) error {
 
 	query := `delete from genres where id = $1`
 
-	_, err := m.Db.ExecContext(ctx, query, id)
+	result, err := m.Db.ExecContext(ctx, query, id)
 
 	if err != nil {
 		return err
 	}
 
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	m.invalidateCatalog()
+
 	return nil
 }
 
-// Check rating
-func (m *DbModel) CheckRating(movieID, userID int) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// MergeGenres moves the movies and sub-genres of sourceID to targetID and deletes sourceID,
+// all in one transaction. It returns the number of movies moved to the target genre.
+func (m *DbModel) MergeGenres(sourceID, targetID int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	query := `select id from ratings where movie_id = $1 and user_id = $2`
+	if sourceID == targetID {
+		return 0, errors.New("a genre can't be merged into itself")
+	}
 
-	ratingID := 0
+	tx, err := m.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
-	err := m.Db.QueryRowContext(ctx, query, movieID, userID).Scan(&ratingID)
+	// lock both genres so they can't change while the links are moved
+	rows, err := tx.QueryContext(ctx, `select id from genres where id in ($1, $2) for update`, sourceID, targetID)
 	if err != nil {
-		return 0, errors.New("Rating not found")
+		return 0, err
+	}
+	found := 0
+	for rows.Next() {
+		found++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if found != 2 {
+		return 0, sql.ErrNoRows
 	}
 
-	return ratingID, nil
+	// moving the sub-genres under a descendant of the source would create a cycle
+	cycle, err := isGenreDescendant(ctx, tx, targetID, sourceID)
+	if err != nil {
+		return 0, err
+	}
+	if cycle {
+		return 0, ErrGenreCycle
+	}
+
+	// move one link per movie, the movies already in the target genre keep their link
+	query := `update movies_genres mg set genre_id = $2, updated_at = $3
+	where mg.id in (select min(id) from movies_genres where genre_id = $1 group by movie_id)
+	and not exists (select 1 from movies_genres x where x.movie_id = mg.movie_id and x.genre_id = $2)`
+
+	result, err := tx.ExecContext(ctx, query, sourceID, targetID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	moved, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `update genres set parent_id = $2, updated_at = $3 where parent_id = $1`, sourceID, targetID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	// the leftover links of the source are removed by the cascade
+	_, err = tx.ExecContext(ctx, `delete from genres where id = $1`, sourceID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	m.invalidateCatalog()
+
+	return int(moved), nil
 }
 
-// InsertRating inserts a new rating into the database
-func (m *DbModel) InsertRating(rating *Rating) (int, error) {
+// InsertRating saves the rating of a user for a movie, replacing the previous one. It relies on the
+// unique (movie_id, user_id) constraint so concurrent submissions can't create two ratings.
+// It reports whether the rating was created, and returns sql.ErrNoRows when the movie doesn't exist.
+func (m *DbModel) InsertRating(rating *Rating) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `insert into ratings (movie_id, user_id, rating, created_at, updated_at) values ($1, $2, $3, $4, $5) returning id`
+	created, err := upsertRating(ctx, m.Db, rating)
+	if err != nil {
+		return false, err
+	}
 
-	var id int
-	err := m.Db.QueryRowContext(ctx, query, rating.MovieID, rating.UserID, rating.Rating, rating.CreatedAt, rating.UpdatedAt).Scan(&id)
+	m.invalidateMovie(rating.MovieID)
 
+	return created, nil
+}
+
+// upsertRating runs the statement of InsertRating with q, so it can be part of a transaction
+func upsertRating(ctx context.Context, q queryRower, rating *Rating) (bool, error) {
+	query := `insert into ratings (movie_id, user_id, rating, created_at, updated_at) values ($1, $2, $3, $4, $5)
+	on conflict (movie_id, user_id) do update set rating = excluded.rating, updated_at = excluded.updated_at
+	returning id, created_at, (xmax = 0) as created`
+
+	var created bool
+	err := q.QueryRowContext(ctx, query, rating.MovieID, rating.UserID, rating.Rating, rating.CreatedAt, rating.UpdatedAt).Scan(&rating.ID, &rating.CreatedAt, &created)
 	if err != nil {
-		return 0, err
+		if isForeignKeyViolation(err) {
+			return false, sql.ErrNoRows
+		}
+		return false, err
 	}
 
-	return id, nil
+	return created, nil
 }
 
-// UpdateRating updates a rating in the database
-func (m *DbModel) UpdateRating(rating *Rating) (int, error) {
+// DeleteRating deletes the rating of a user for a movie, sql.ErrNoRows when there is none
+func (m *DbModel) DeleteRating(movieID, userID int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `update ratings set rating = $1, updated_at = $2 where id = $3`
+	result, err := m.Db.ExecContext(ctx, `delete from ratings where movie_id = $1 and user_id = $2`, movieID, userID)
+	if err != nil {
+		return err
+	}
 
-	_, err := m.Db.ExecContext(ctx, query, rating.Rating, rating.UpdatedAt, rating.ID)
+	rows, err := result.RowsAffected()
 	if err != nil {
-		return rating.ID, errors.New("Rating not found")
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
 	}
 
-	return rating.ID, nil
+	m.invalidateMovie(movieID)
+
+	return nil
 }
 
 // getting gerne by id
@@ -240,11 +357,13 @@ func (m *DbModel) GetGenreByID(id int) (*Genre, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `select id, genre_name, created_at, updated_at from genres where id = $1`
+	query := `select g.id, g.genre_name, g.parent_id, g.created_at, g.updated_at,
+	(select count(distinct mg.movie_id) from movies_genres mg where mg.genre_id = g.id) as movie_count
+	from genres g where g.id = $1`
 
 	var genre Genre
 
-	err := m.Db.QueryRowContext(ctx, query, id).Scan(&genre.ID, &genre.GenreName, &genre.CreatedAt, &genre.UpdatedAt)
+	err := m.Db.QueryRowContext(ctx, query, id).Scan(&genre.ID, &genre.GenreName, &genre.ParentID, &genre.CreatedAt, &genre.UpdatedAt, &genre.MovieCount)
 	if err != nil {
 		return nil, err
 	}
@@ -254,10 +373,19 @@ func (m *DbModel) GetGenreByID(id int) (*Genre, error) {
 
 // getting all genres
 func (m *DbModel) GetAllGenres() ([]*Genre, error) {
+	return cached(m, "genres:all", genresTTL, m.getAllGenres)
+}
+
+func (m *DbModel) getAllGenres() ([]*Genre, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `select id, genre_name, created_at, updated_at from genres`
+	query := `select g.id, g.genre_name, g.parent_id, g.created_at, g.updated_at,
+	count(distinct mg.movie_id) as movie_count
+	from genres g
+	left join movies_genres mg on (mg.genre_id = g.id)
+	group by g.id
+	order by g.genre_name`
 
 	rows, err := m.Db.QueryContext(ctx, query)
 	if err != nil {
@@ -268,7 +396,7 @@ func (m *DbModel) GetAllGenres() ([]*Genre, error) {
 	var genres []*Genre
 	for rows.Next() {
 		var genre Genre
-		err := rows.Scan(&genre.ID, &genre.GenreName, &genre.CreatedAt, &genre.UpdatedAt)
+		err := rows.Scan(&genre.ID, &genre.GenreName, &genre.ParentID, &genre.CreatedAt, &genre.UpdatedAt, &genre.MovieCount)
 		if err != nil {
 			return nil, err
 		}
@@ -278,14 +406,131 @@ func (m *DbModel) GetAllGenres() ([]*Genre, error) {
 	return genres, nil
 }
 
+// GetGenreStats returns the catalog statistics of every genre, computed in a single query
+func (m *DbModel) GetGenreStats() ([]*GenreStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// ratings, favorites and comments are counted per movie first so the joins don't multiply each other
+	query := `
+	WITH genre_movies AS (
+		SELECT DISTINCT genre_id, movie_id FROM movies_genres
+	), movie_ratings AS (
+		SELECT movie_id, SUM(rating) AS total, COUNT(*) AS votes FROM ratings GROUP BY movie_id
+	), movie_favorites AS (
+		SELECT movie_id, COUNT(*) AS favorites FROM favorites GROUP BY movie_id
+	), movie_comments AS (
+		SELECT movie_id, COUNT(*) AS comments FROM comments WHERE deleted_at IS NULL AND status = 'published' GROUP BY movie_id
+	), newest AS (
+		SELECT DISTINCT ON (gm.genre_id) gm.genre_id, m.id, m.title, m.release_date
+		FROM genre_movies gm
+		JOIN movies m ON (m.id = gm.movie_id)
+		WHERE m.release_date IS NOT NULL
+		ORDER BY gm.genre_id, m.release_date DESC, m.id DESC
+	)
+	SELECT g.id, g.genre_name,
+		COUNT(gm.movie_id) AS movie_count,
+		COALESCE(SUM(mr.votes), 0) AS rating_count,
+		TRUNC((SUM(mr.total)::float8 / NULLIF(SUM(mr.votes), 0)::float8)::numeric, 1) AS average_rating,
+		COALESCE(SUM(mf.favorites), 0) AS total_favorites,
+		COALESCE(SUM(mc.comments), 0) AS total_comments,
+		n.id, n.title, n.release_date
+	FROM genres g
+	LEFT JOIN genre_movies gm ON (gm.genre_id = g.id)
+	LEFT JOIN movie_ratings mr ON (mr.movie_id = gm.movie_id)
+	LEFT JOIN movie_favorites mf ON (mf.movie_id = gm.movie_id)
+	LEFT JOIN movie_comments mc ON (mc.movie_id = gm.movie_id)
+	LEFT JOIN newest n ON (n.genre_id = g.id)
+	GROUP BY g.id, g.genre_name, n.id, n.title, n.release_date
+	ORDER BY g.genre_name`
+
+	rows, err := m.Db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []*GenreStats{}
+	for rows.Next() {
+		var s GenreStats
+		var newestID sql.NullInt64
+		var newestTitle sql.NullString
+		var newestDate sql.NullTime
+		err := rows.Scan(
+			&s.GenreID,
+			&s.GenreName,
+			&s.MovieCount,
+			&s.RatingCount,
+			&s.AverageRating,
+			&s.TotalFavorites,
+			&s.TotalComments,
+			&newestID,
+			&newestTitle,
+			&newestDate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if newestID.Valid {
+			s.NewestRelease = &GenreRelease{
+				MovieID:     int(newestID.Int64),
+				Title:       newestTitle.String,
+				ReleaseDate: newestDate.Time,
+			}
+		}
+		stats = append(stats, &s)
+	}
+
+	return stats, rows.Err()
+}
+
+// BuildGenreTree nests a flat list of genres under their parents and returns the top level genres.
+// Genres whose parent is not in the list are treated as top level.
+func BuildGenreTree(genres []*Genre) []*Genre {
+	byID := make(map[int]*Genre, len(genres))
+	for _, genre := range genres {
+		byID[genre.ID] = genre
+	}
+
+	roots := []*Genre{}
+	for _, genre := range genres {
+		if genre.ParentID != nil {
+			if parent, ok := byID[*genre.ParentID]; ok && parent != genre {
+				parent.Children = append(parent.Children, genre)
+				continue
+			}
+		}
+		roots = append(roots, genre)
+	}
+
+	return roots
+}
+
 // get latest Movies Featured on the website
-func (m *DbModel) GetLatestMovies(userID ...int) ([]*Movie, error) {
+func (m *DbModel) GetLatestMovies(opts MovieOptions) ([]*Movie, error) {
+	// the cached list is shared by every user, their flags are set afterwards
+	movies, err := cached(m, "movies:latest:"+opts.Fields.key(), latestTTL, func() ([]*Movie, error) {
+		return m.getLatestMovies(MovieOptions{Fields: opts.Fields})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.loadUserFlags(movies, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
+func (m *DbModel) getLatestMovies(opts MovieOptions) ([]*Movie, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	query := `
-		SELECT m.id, m.title, m.image, m.description, m.year, m.release_date,
-		COALESCE(TRUNC(AVG(r.rating)::numeric, 1), 1.0) AS rating,
+		SELECT m.id, m.title, m.image, ` + opts.Fields.column("description", "m.description", "''") + `, m.year, m.release_date,
+		TRUNC(AVG(r.rating)::numeric, 1) AS rating, COUNT(r.id) AS rating_count,
 		m.runtime, m.created_at, m.updated_at
 		FROM movies m
 		LEFT JOIN ratings r ON r.movie_id = m.id
@@ -312,6 +557,7 @@ func (m *DbModel) GetLatestMovies(userID ...int) ([]*Movie, error) {
 			&movie.Year,
 			&movie.ReleaseDate,
 			&movie.Rating,
+			&movie.RatingCount,
 			&movie.Runtime,
 			&movie.CreatedAt,
 			&movie.UpdatedAt,
@@ -324,88 +570,42 @@ func (m *DbModel) GetLatestMovies(userID ...int) ([]*Movie, error) {
 		} else {
 			movie.Image = fmt.Sprintf("https://res.cloudinary.com/%s/image/upload/%s", os.Getenv("CLOUD_NAME"), image.String)
 		}
-		movie.MovieGenre = make(map[int]string)
-
-		// get genres, if any
-		genreQuery := `SELECT
-                mg.id, mg.movie_id, mg.genre_id, g.genre_name
-            FROM
-                movies_genres mg
-                LEFT JOIN genres g ON (g.id = mg.genre_id)
-            WHERE
-                mg.movie_id = $1`
-
-		genreRows, err := m.Db.QueryContext(ctx, genreQuery, movie.ID)
-		if err != nil {
-			return nil, err
-		}
-
-		for genreRows.Next() {
-			var genreID int
-			var genreName string
-			err := genreRows.Scan(
-				new(int), // We don't need the id from movies_genres
-				new(int), // We don't need the movie_id
-				&genreID,
-				&genreName)
-
-			if err != nil {
-				genreRows.Close()
-				return nil, err
-			}
-
-			movie.MovieGenre[genreID] = genreName
-		}
-		genreRows.Close()
-
-		if len(userID) > 0 {
-			// check if movie is favorite
-			favoriteQuery := `select id from favorites where movie_id = $1 and user_id = $2`
-			_ = m.Db.QueryRowContext(ctx, favoriteQuery, movie.ID, userID[0]).Scan(&movie.IsFavorite)
-		}
 
 		movies = append(movies, &movie)
 	}
 
+	err = m.attachRelations(ctx, movies, opts)
+	if err != nil {
+		return nil, err
+	}
+
 	return movies, nil
 }
 
-func (m *DbModel) GetMoviesByGenre(genreID int) ([]*Movie, error) {
+// GetMoviesByGenre returns the movies of a genre. When includeSubgenres is set the movies
+// tagged only with one of its descendant genres are returned as well.
+func (m *DbModel) GetMoviesByGenre(genreID int, includeSubgenres bool, opts MovieOptions) ([]*Movie, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	// genre_tree walks down the hierarchy, UNION makes it stop if the data ever contains a cycle
 	query := `
-    SELECT DISTINCT ON (m.id)
-        m.id, 
-        m.title, 
-		m.image,
-        m.description, 
-        m.year, 
-        m.release_date, 
-        COALESCE(trunc(AVG(r.rating)::numeric, 1), 1.0) AS rating, 
-        m.runtime, 
-        m.created_at, 
-        m.updated_at,
-        array_agg(DISTINCT g.id) AS genre_ids,
-        array_agg(DISTINCT g.genre_name) AS genre_names
+    WITH RECURSIVE genre_tree AS (
+        SELECT id FROM genres WHERE id = $1
+        UNION
+        SELECT g.id FROM genres g JOIN genre_tree gt ON (g.parent_id = gt.id) WHERE $2::boolean
+    )
+    SELECT ` + movieColumns(opts.Fields) + `
     FROM movies m
-    JOIN movies_genres mg ON (mg.movie_id = m.id)
-    JOIN genres g ON (g.id = mg.genre_id)
     LEFT JOIN ratings r ON (r.movie_id = m.id)
-    WHERE mg.genre_id = $1
-    GROUP BY 
-        m.id, 
-        m.title, 
-        m.description, 
-        m.year, 
-        m.release_date, 
-        m.runtime, 
-        m.created_at, 
-        m.updated_at
-    ORDER BY m.id, rating DESC
+    WHERE m.id IN (
+        SELECT mg.movie_id FROM movies_genres mg WHERE mg.genre_id IN (SELECT id FROM genre_tree)
+    )
+    GROUP BY m.id
+    ORDER BY m.id
     `
 
-	rows, err := m.Db.QueryContext(ctx, query, genreID)
+	rows, err := m.Db.QueryContext(ctx, query, genreID, includeSubgenres)
 	if err != nil {
 		return nil, err
 	}
@@ -413,52 +613,56 @@ func (m *DbModel) GetMoviesByGenre(genreID int) ([]*Movie, error) {
 
 	var movies []*Movie
 	for rows.Next() {
-		var image sql.NullString
-		var movie Movie
-		var genreIDs []int64 // Changed to int64
-		var genreNames []string
-
-		err := rows.Scan(
-			&movie.ID,
-			&movie.Title,
-			&image,
-			&movie.Description,
-			&movie.Year,
-			&movie.ReleaseDate,
-			&movie.Rating,
-			&movie.Runtime,
-			&movie.CreatedAt,
-			&movie.UpdatedAt,
-			pq.Array(&genreIDs),
-			pq.Array(&genreNames),
-		)
+		movie, err := scanMovie(rows)
 		if err != nil {
 			return nil, err
 		}
-		if !image.Valid || image.String == "" {
-			movie.Image = "https://res.cloudinary.com/dvc85iwpj/image/upload/v1720247654/download_i0205y.png"
-		} else {
-			movie.Image = fmt.Sprintf("https://res.cloudinary.com/%s/image/upload/%s", os.Getenv("CLOUD_NAME"), image.String)
-		}
-
-		movie.MovieGenre = make(map[int]string)
-		for i, id := range genreIDs {
-			movie.MovieGenre[int(id)] = genreNames[i] // Convert int64 to int
-		}
+		movies = append(movies, movie)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-		movies = append(movies, &movie)
+	err = m.attachRelations(ctx, movies, opts)
+	if err != nil {
+		return nil, err
 	}
 
 	return movies, nil
 }
 
-func (m *DbModel) GetMovie(id int) (*Movie, error) {
+// GetMovie returns the details of a movie, loading only the relations asked for in include
+func (m *DbModel) GetMovie(id int, include MovieInclude, opts MovieOptions) (*Movie, error) {
+	key := fmt.Sprintf("movie:%d:%v:%s", id, include, opts.Fields.key())
+	movie, err := cached(m, key, movieTTL, func() (*Movie, error) {
+		return m.getMovie(id, include, MovieOptions{Fields: opts.Fields})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.loadUserFlags([]*Movie{movie}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.loadMyReactions(movie.Comments, opts.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return movie, nil
+}
+
+func (m *DbModel) getMovie(id int, include MovieInclude, opts MovieOptions) (*Movie, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `SELECT m.id, m.title, m.description, m.year, m.release_date, m.runtime, m.image, m.created_at, m.updated_at,
-    COALESCE(TRUNC(AVG(r.rating)::numeric, 1), 1.0) AS rating,
-		COUNT(DISTINCT f.id) AS favorites_count
+	query := `SELECT m.id, m.title, ` + opts.Fields.column("description", "m.description", "''") + `, m.year, m.release_date, m.runtime, m.image, m.created_at, m.updated_at,
+    TRUNC(AVG(r.rating)::numeric, 1) AS rating,
+		COUNT(DISTINCT r.id) AS rating_count,
+		COUNT(DISTINCT f.id) AS favorites_count,
+		(SELECT COUNT(*) FROM comments c WHERE c.movie_id = m.id AND c.deleted_at IS NULL AND c.status = 'published') AS comments_count
 FROM movies m
 LEFT JOIN ratings r ON r.movie_id = m.id
 LEFT JOIN favorites f ON f.movie_id = m.id
@@ -482,80 +686,426 @@ GROUP BY m.id;
 		&movie.CreatedAt,
 		&movie.UpdatedAt,
 		&movie.Rating,
+		&movie.RatingCount,
 		&movie.TotalFavorites,
+		&movie.TotalComments,
 	)
 	if err != nil {
 		return nil, err
 	}
 
 	// Check if the Image value is NULL or empty, and if it is, assign a default value
-	if !image.Valid || image.String == "" {
-		movie.Image = "https://res.cloudinary.com/dvc85iwpj/image/upload/v1720247654/download_i0205y.png"
-	} else {
-		movie.Image = fmt.Sprintf("https://res.cloudinary.com/%s/image/upload/%s", os.Getenv("CLOUD_NAME"), image.String)
-	}
-
-	movie.MovieGenre = make(map[int]string)
-	// get genres, if any
-	genreQuery := `select
-	mg.id, mg.movie_id, mg.genre_id, g.genre_name
-from
-	movies_genres mg
-	left join genres g on (g.id = mg.genre_id)
-where
-	mg.movie_id = $1
-`
+	movie.Image = imageURL(image)
 
-	genreRows, _ := m.Db.QueryContext(ctx, genreQuery, movie.ID)
+	if include.Genres {
+		err = m.attachGenres(ctx, []*Movie{&movie})
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	for genreRows.Next() {
-		var mg MovieGenre
-		err := genreRows.Scan(
-			&mg.ID,
-			&mg.MovieID,
-			&mg.GenreID,
-			&mg.Genre.GenreName,
-		)
+	if include.Tags {
+		err = m.attachTags(ctx, []*Movie{&movie})
 		if err != nil {
 			return nil, err
 		}
-		movie.MovieGenre[mg.GenreID] = mg.Genre.GenreName
-	}
-	defer genreRows.Close()
-
-	// Get comments ordered by recent update
-	query = `SELECT
-    c.id, c.user_id, c.comment, c.created_at, c.updated_at, u.name
-    FROM
-    	comments c
-    LEFT JOIN users u ON (u.id = c.user_id)
-    WHERE
-    	c.movie_id = $1
-  	ORDER BY c.created_at DESC
-    `
+	}
+
+	if include.Comments {
+		movie.Comments, movie.CommentsCursor, err = m.movieComments(ctx, movie.ID, CommentPage{Sort: "newest", Limit: include.CommentsLimit})
+		if err != nil {
+			return nil, err
+		}
+		err = m.attachReactionCounts(ctx, movie.Comments)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if include.Ratings {
+		movie.Ratings, err = m.movieRatings(ctx, movie.ID, include.RatingsLimit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if include.Favorites {
+		movie.Favorites, err = m.movieFavorites(ctx, movie.ID, include.FavoritesLimit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if include.RatingSummary {
+		movie.RatingSummary, err = m.ratingSummary(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &movie, nil
+}
 
-	rows, _ := m.Db.QueryContext(ctx, query, id)
+// limitArg turns a limit into a query argument, LIMIT NULL returns every row
+func limitArg(limit int) interface{} {
+	if limit <= 0 {
+		return nil
+	}
+	return limit
+}
+
+// movieRatings returns the ratings of a movie, most recent first
+func (m *DbModel) movieRatings(ctx context.Context, movieID, limit int) ([]Rating, error) {
+	query := `SELECT id, movie_id, user_id, rating, created_at, updated_at
+	FROM ratings
+	WHERE movie_id = $1
+	ORDER BY updated_at DESC
+	LIMIT $2`
+
+	rows, err := m.Db.QueryContext(ctx, query, movieID, limitArg(limit))
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
-	var comments []Comment
+	ratings := []Rating{}
 	for rows.Next() {
-		var comment Comment
+		var rating Rating
+		err := rows.Scan(&rating.ID, &rating.MovieID, &rating.UserID, &rating.Rating, &rating.CreatedAt, &rating.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		ratings = append(ratings, rating)
+	}
+
+	return ratings, rows.Err()
+}
+
+// movieFavorites returns the favorites of a movie, most recent first
+func (m *DbModel) movieFavorites(ctx context.Context, movieID, limit int) ([]Favorite, error) {
+	query := `SELECT id, user_id, movie_id, created_at, updated_at
+	FROM favorites
+	WHERE movie_id = $1
+	ORDER BY updated_at DESC
+	LIMIT $2`
+
+	rows, err := m.Db.QueryContext(ctx, query, movieID, limitArg(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	favorites := []Favorite{}
+	for rows.Next() {
+		var favorite Favorite
+		err := rows.Scan(&favorite.ID, &favorite.UserID, &favorite.MovieID, &favorite.CreatedAt, &favorite.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		favorites = append(favorites, favorite)
+	}
+
+	return favorites, rows.Err()
+}
+
+// GetTopMovies returns the top rated movies ranked by a bayesian (IMDb style) weighted rating.
+// Movies with less than minVotes ratings are left out of the chart.
+func (m *DbModel) GetTopMovies(minVotes, limit int, opts MovieOptions) ([]*Movie, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// weighted rating = (v / (v + m)) * R + (m / (v + m)) * C
+	// v: votes of the movie, m: minimum votes, R: average of the movie, C: average over all the ratings
+	query := `
+	WITH stats AS (
+		SELECT movie_id, AVG(rating) AS avg_rating, COUNT(*) AS votes
+		FROM ratings
+		GROUP BY movie_id
+	), global AS (
+		SELECT COALESCE(AVG(rating), 0) AS mean FROM ratings
+	)
+	SELECT m.id, m.title, m.image, ` + opts.Fields.column("description", "m.description", "''") + `, m.year, m.release_date,
+		TRUNC(s.avg_rating::numeric, 1) AS rating, s.votes AS rating_count,
+		(s.votes::float8 / (s.votes + $1::int)) * s.avg_rating
+			+ ($1::int::float8 / (s.votes + $1::int)) * g.mean AS weighted_rating,
+		m.runtime, m.created_at, m.updated_at
+	FROM movies m
+	JOIN stats s ON (s.movie_id = m.id)
+	CROSS JOIN global g
+	WHERE s.votes >= $1::int
+	ORDER BY weighted_rating DESC, s.votes DESC, m.id ASC
+	LIMIT $2
+	`
+
+	rows, err := m.Db.QueryContext(ctx, query, minVotes, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movies []*Movie
+	for rows.Next() {
+		var movie Movie
+		var image sql.NullString
 		err := rows.Scan(
-			&comment.ID,
-			&comment.UserID,
-			&comment.Comment,
-			&comment.CreatedAt,
-			&comment.UpdatedAt,
-			&comment.UserName,
+			&movie.ID,
+			&movie.Title,
+			&image,
+			&movie.Description,
+			&movie.Year,
+			&movie.ReleaseDate,
+			&movie.Rating,
+			&movie.RatingCount,
+			&movie.WeightedRating,
+			&movie.Runtime,
+			&movie.CreatedAt,
+			&movie.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
 		}
-		comments = append(comments, comment)
+		movie.Image = imageURL(image)
+		movies = append(movies, &movie)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	movie.Comments = comments
-	movie.TotalComments = len(comments)
+	err = m.attachRelations(ctx, movies, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
+// movieColumns returns the columns selected by the movie listings, in the order scanMovie reads them.
+// The query has to alias movies as m, ratings as r and group by m.id.
+func movieColumns(fields FieldSet) string {
+	return `m.id, m.title, m.image, ` + fields.column("description", "m.description", "''") + `, m.year, m.release_date,
+	TRUNC(AVG(r.rating)::numeric, 1) AS rating, COUNT(DISTINCT r.id) AS rating_count,
+	m.runtime, m.created_at, m.updated_at`
+}
 
+// scanMovie reads a row selected with movieColumns
+func scanMovie(rows *sql.Rows) (*Movie, error) {
+	var movie Movie
+	var image sql.NullString
+	err := rows.Scan(
+		&movie.ID,
+		&movie.Title,
+		&image,
+		&movie.Description,
+		&movie.Year,
+		&movie.ReleaseDate,
+		&movie.Rating,
+		&movie.RatingCount,
+		&movie.Runtime,
+		&movie.CreatedAt,
+		&movie.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	movie.Image = imageURL(image)
 	return &movie, nil
 }
+
+// MoviesLastModified returns the last time one of the movies, or a row related to them, was updated
+func (m *DbModel) MoviesLastModified(ids []int) (time.Time, error) {
+	if len(ids) == 0 {
+		return time.Time{}, nil
+	}
+
+	key := "movies:lastmod:" + idsKey(ids)
+	if len(ids) == 1 {
+		key = fmt.Sprintf("movie:%d:lastmod", ids[0])
+	}
+	return cached(m, key, movieTTL, func() (time.Time, error) {
+		return m.moviesLastModified(ids)
+	})
+}
+
+// moviesLastModified relies on the touch_movie trigger, writing or deleting a rating, favorite, comment,
+// genre link or tag link bumps movies.updated_at in the same transaction. Only the renames of the genres
+// and tags shared by many movies have to be read from their own rows.
+func (m *DbModel) moviesLastModified(ids []int) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	movieIDs := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		movieIDs = append(movieIDs, int64(id))
+	}
+
+	query := `SELECT GREATEST(
+		(SELECT MAX(updated_at) FROM movies WHERE id = ANY($1)),
+		(SELECT MAX(g.updated_at) FROM genres g JOIN movies_genres mg ON (mg.genre_id = g.id) WHERE mg.movie_id = ANY($1)),
+		(SELECT MAX(t.updated_at) FROM tags t JOIN movies_tags mt ON (mt.tag_id = t.id) WHERE mt.movie_id = ANY($1))
+	)`
+
+	var lastModified sql.NullTime
+	err := m.Db.QueryRowContext(ctx, query, pq.Array(movieIDs)).Scan(&lastModified)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return lastModified.Time, nil
+}
+
+// GenresLastModified returns the last time a genre was updated
+func (m *DbModel) GenresLastModified() (time.Time, error) {
+	return cached(m, "genres:lastmod", genresTTL, m.genresLastModified)
+}
+
+func (m *DbModel) genresLastModified() (time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var lastModified sql.NullTime
+	err := m.Db.QueryRowContext(ctx, `SELECT MAX(updated_at) FROM genres`).Scan(&lastModified)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return lastModified.Time, nil
+}
+
+// movieExists reports whether a movie with the given id exists
+func (m *DbModel) movieExists(ctx context.Context, id int) (bool, error) {
+	var exists bool
+	err := m.Db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM movies WHERE id = $1)`, id).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// attachRelations loads the genres and tags of the movies, unless they were left out of opts.Fields,
+// and the flags of opts.UserID
+func (m *DbModel) attachRelations(ctx context.Context, movies []*Movie, opts MovieOptions) error {
+	if opts.Fields.Has("genres") {
+		err := m.attachGenres(ctx, movies)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.Fields.Has("tags") {
+		err := m.attachTags(ctx, movies)
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.attachUserFlags(ctx, movies, opts)
+}
+
+// loadUserFlags sets the flags of opts.UserID on movies read from the cache, which are shared by every user
+func (m *DbModel) loadUserFlags(movies []*Movie, opts MovieOptions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.attachUserFlags(ctx, movies, opts)
+}
+
+// attachUserFlags sets is_favorite, my_rating and in_watchlist for opts.UserID on all the movies
+// with a single query. Anonymous requests and field sets without the flags are skipped.
+func (m *DbModel) attachUserFlags(ctx context.Context, movies []*Movie, opts MovieOptions) error {
+	if opts.UserID == 0 || len(movies) == 0 {
+		return nil
+	}
+	if !opts.Fields.Has("is_favorite") && !opts.Fields.Has("my_rating") && !opts.Fields.Has("in_watchlist") {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(movies))
+	byID := make(map[int][]*Movie, len(movies))
+	for _, movie := range movies {
+		ids = append(ids, int64(movie.ID))
+		byID[movie.ID] = append(byID[movie.ID], movie)
+	}
+
+	query := `SELECT m.id,
+		EXISTS(SELECT 1 FROM favorites f WHERE f.movie_id = m.id AND f.user_id = $2),
+		(SELECT r.rating FROM ratings r WHERE r.movie_id = m.id AND r.user_id = $2),
+		EXISTS(SELECT 1 FROM watchlist w WHERE w.movie_id = m.id AND w.user_id = $2)
+	FROM unnest($1::bigint[]) AS m(id)`
+
+	rows, err := m.Db.QueryContext(ctx, query, pq.Array(ids), opts.UserID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movieID int
+		var isFavorite, inWatchlist bool
+		var myRating sql.NullFloat64
+		err := rows.Scan(&movieID, &isFavorite, &myRating, &inWatchlist)
+		if err != nil {
+			return err
+		}
+		for _, movie := range byID[movieID] {
+			movie.IsFavorite = isFavorite
+			movie.InWatchlist = inWatchlist
+			if myRating.Valid {
+				rating := myRating.Float64
+				movie.MyRating = &rating
+			}
+		}
+	}
+
+	return rows.Err()
+}
+
+// defaultImage is the poster used for movies without an uploaded image
+const defaultImage = "https://res.cloudinary.com/dvc85iwpj/image/upload/v1720247654/download_i0205y.png"
+
+// imageURL builds the cloudinary url of a movie image, falling back to the default poster
+func imageURL(image sql.NullString) string {
+	if !image.Valid || image.String == "" {
+		return defaultImage
+	}
+	return fmt.Sprintf("https://res.cloudinary.com/%s/image/upload/%s", os.Getenv("CLOUD_NAME"), image.String)
+}
+
+// attachGenres loads the genres of all the given movies with a single query
+func (m *DbModel) attachGenres(ctx context.Context, movies []*Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(movies))
+	byID := make(map[int]*Movie, len(movies))
+	for _, movie := range movies {
+		movie.MovieGenre = make(map[int]string)
+		ids = append(ids, int64(movie.ID))
+		byID[movie.ID] = movie
+	}
+
+	query := `SELECT mg.movie_id, g.id, g.genre_name
+	FROM movies_genres mg
+	JOIN genres g ON (g.id = mg.genre_id)
+	WHERE mg.movie_id = ANY($1)`
+
+	rows, err := m.Db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movieID, genreID int
+		var genreName string
+		err := rows.Scan(&movieID, &genreID, &genreName)
+		if err != nil {
+			return err
+		}
+		if movie, ok := byID[movieID]; ok {
+			movie.MovieGenre[genreID] = genreName
+		}
+	}
+
+	return rows.Err()
+}
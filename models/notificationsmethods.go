@@ -0,0 +1,228 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// NotificationTypes are the kinds of notifications, users receive all of them unless they opt out
+var NotificationTypes = []string{
+	"reply",     // someone replied to a comment of the user
+	"new_movie", // a movie was added to a genre of the favorites of the user
+}
+
+// notificationAllowed is the condition of the producers skipping the users who opted out, $1 is the type
+// and n_user the column holding the user
+const notificationAllowed = `NOT EXISTS (
+	SELECT 1 FROM notification_preferences np WHERE np.user_id = n_user AND np.type = $1 AND NOT np.enabled
+)`
+
+// Notify adds a notification to the inbox of n.UserID, unless the user opted out of its type.
+// It's the producer the other parts of the code use, NotifyReply builds on it.
+func (m *DbModel) Notify(n *Notification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO notifications (user_id, type, actor_id, movie_id, comment_id, message, created_at)
+	SELECT n_user, $1, $3, $4, $5, $6, $7 FROM (SELECT $2::int AS n_user) u
+	WHERE ` + notificationAllowed + `
+	RETURNING id`
+
+	err := m.Db.QueryRowContext(ctx, query, n.Type, n.UserID, n.ActorID, n.MovieID, n.CommentID, n.Message, n.CreatedAt).Scan(&n.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	return nil
+}
+
+// NotifyReply tells the author of the parent comment about a reply, replies to oneself are skipped
+func (m *DbModel) NotifyReply(reply *Comment) error {
+	if reply.ParentID == nil {
+		return nil
+	}
+
+	parent, err := m.GetComment(*reply.ParentID)
+	if err != nil {
+		return err
+	}
+	if parent.UserID == reply.UserID || parent.Deleted {
+		return nil
+	}
+
+	return m.Notify(&Notification{
+		UserID:    parent.UserID,
+		Type:      "reply",
+		ActorID:   &reply.UserID,
+		MovieID:   &reply.MovieID,
+		CommentID: &reply.ID,
+		Message:   "New reply to your comment",
+		CreatedAt: reply.CreatedAt,
+	})
+}
+
+// NotifyNewMovie tells the users having a favorite movie in one of the genres of a new movie about it,
+// with one query fanning out to every fan. The API has no endpoint adding movies yet, so nothing calls it:
+// the code inserting a movie has to call it once the genres of the movie are linked.
+func (m *DbModel) NotifyNewMovie(movieID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO notifications (user_id, type, movie_id, message, created_at)
+	SELECT n_user, $1, $2, 'New in a genre you like: ' || (SELECT title FROM movies WHERE id = $2), $3
+	FROM (
+		SELECT DISTINCT f.user_id AS n_user
+		FROM favorites f
+		JOIN movies_genres mg ON (mg.movie_id = f.movie_id)
+		WHERE f.movie_id <> $2 AND mg.genre_id IN (SELECT genre_id FROM movies_genres WHERE movie_id = $2)
+	) fans
+	WHERE ` + notificationAllowed
+
+	_, err := m.Db.ExecContext(ctx, query, "new_movie", movieID, time.Now())
+	return err
+}
+
+// GetNotifications returns a page of the inbox of a user, most recent first, with the unread count
+func (m *DbModel) GetNotifications(userID int, unreadOnly bool, page, perPage int) (*NotificationInbox, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	inbox := &NotificationInbox{PerPage: perPage, CurrentPage: page, Notifications: []*Notification{}}
+
+	query := `SELECT COUNT(*) FILTER (WHERE read_at IS NULL), COUNT(*) FILTER (WHERE read_at IS NULL OR NOT $2)
+	FROM notifications WHERE user_id = $1`
+	err := m.Db.QueryRowContext(ctx, query, userID, unreadOnly).Scan(&inbox.UnreadCount, &inbox.TotalCount)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `SELECT n.id, n.user_id, n.type, n.actor_id, COALESCE(u.name, ''), n.movie_id, n.comment_id, n.message, n.read_at, n.created_at
+	FROM notifications n
+	LEFT JOIN users u ON (u.id = n.actor_id)
+	WHERE n.user_id = $1 AND (n.read_at IS NULL OR NOT $2)
+	ORDER BY n.created_at DESC, n.id DESC
+	LIMIT $3 OFFSET $4`
+
+	rows, err := m.Db.QueryContext(ctx, query, userID, unreadOnly, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n Notification
+		err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.ActorID, &n.ActorName, &n.MovieID, &n.CommentID, &n.Message, &n.ReadAt, &n.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		inbox.Notifications = append(inbox.Notifications, &n)
+	}
+
+	return inbox, rows.Err()
+}
+
+// MarkNotificationRead marks a notification of the user read, or unread again. It returns sql.ErrNoRows
+// when the user has no such notification.
+func (m *DbModel) MarkNotificationRead(id, userID int, read bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var readAt interface{}
+	if read {
+		readAt = time.Now()
+	}
+
+	// a notification already read keeps its first read_at
+	query := `UPDATE notifications SET read_at = CASE WHEN $1::timestamp IS NULL THEN NULL ELSE COALESCE(read_at, $1) END
+	WHERE id = $2 AND user_id = $3`
+
+	result, err := m.Db.ExecContext(ctx, query, readAt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// MarkAllNotificationsRead marks every unread notification of the user read and returns how many there were
+func (m *DbModel) MarkAllNotificationsRead(userID int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.Db.ExecContext(ctx, `UPDATE notifications SET read_at = $1 WHERE user_id = $2 AND read_at IS NULL`, time.Now(), userID)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := result.RowsAffected()
+	return int(rows), err
+}
+
+// GetNotificationPreferences returns whether the user receives each of the NotificationTypes
+func (m *DbModel) GetNotificationPreferences(userID int) ([]NotificationPreference, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.Db.QueryContext(ctx, `SELECT type, enabled FROM notification_preferences WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	enabled := make(map[string]bool)
+	for rows.Next() {
+		var notificationType string
+		var on bool
+		err := rows.Scan(&notificationType, &on)
+		if err != nil {
+			return nil, err
+		}
+		enabled[notificationType] = on
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	preferences := make([]NotificationPreference, 0, len(NotificationTypes))
+	for _, notificationType := range NotificationTypes {
+		on, ok := enabled[notificationType]
+		preferences = append(preferences, NotificationPreference{Type: notificationType, Enabled: on || !ok})
+	}
+
+	return preferences, nil
+}
+
+// SetNotificationPreferences saves the given preferences of the user, the types left out keep theirs
+func (m *DbModel) SetNotificationPreferences(userID int, preferences []NotificationPreference) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO notification_preferences (user_id, type, enabled, updated_at) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (user_id, type) DO UPDATE SET enabled = excluded.enabled, updated_at = excluded.updated_at`
+
+	now := time.Now()
+	for _, preference := range preferences {
+		_, err = tx.ExecContext(ctx, query, userID, preference.Type, preference.Enabled, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
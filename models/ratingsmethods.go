@@ -0,0 +1,163 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ratingBuckets are the values the rating histogram is split into
+var ratingBuckets = []float64{0.5, 1, 1.5, 2, 2.5, 3, 3.5, 4, 4.5, 5}
+
+// GetRatingSummary returns the vote distribution of a movie.
+// It returns sql.ErrNoRows when the movie does not exist.
+func (m *DbModel) GetRatingSummary(movieID int) (*RatingSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	exists, err := m.movieExists(ctx, movieID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+
+	return m.ratingSummary(ctx, movieID)
+}
+
+// ratingSummary computes the histogram, median and standard deviation of the votes of a movie
+func (m *DbModel) ratingSummary(ctx context.Context, movieID int) (*RatingSummary, error) {
+	query := `SELECT
+		COUNT(*),
+		ROUND(AVG(rating)::numeric, 2),
+		ROUND((percentile_cont(0.5) WITHIN GROUP (ORDER BY rating))::numeric, 2),
+		ROUND(stddev_pop(rating)::numeric, 2)
+	FROM ratings
+	WHERE movie_id = $1`
+
+	summary := RatingSummary{}
+	err := m.Db.QueryRowContext(ctx, query, movieID).Scan(
+		&summary.TotalVotes,
+		&summary.Average,
+		&summary.Median,
+		&summary.StdDev,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// every vote is rounded to the closest half star
+	query = `SELECT
+		LEAST(GREATEST(ROUND(rating::numeric * 2) / 2, 0.5), 5)::float8 AS bucket,
+		COUNT(*)
+	FROM ratings
+	WHERE movie_id = $1
+	GROUP BY bucket`
+
+	rows, err := m.Db.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[float64]int)
+	for rows.Next() {
+		var bucket float64
+		var count int
+		err := rows.Scan(&bucket, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts[bucket] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// empty buckets are kept so clients can draw the chart as is
+	summary.Histogram = make([]RatingBucket, 0, len(ratingBuckets))
+	for _, bucket := range ratingBuckets {
+		summary.Histogram = append(summary.Histogram, RatingBucket{Rating: bucket, Count: counts[bucket]})
+	}
+
+	return &summary, nil
+}
+
+// userRatingsOrder maps the sorts of the rating history to their ORDER BY clause
+var userRatingsOrder = map[string]string{
+	"recent":  "rated_at DESC, r.id DESC",
+	"highest": "r.rating DESC, rated_at DESC, r.id DESC",
+	"lowest":  "r.rating ASC, rated_at DESC, r.id DESC",
+}
+
+// GetUserRatings returns a page of the movies rated by a user with the score they gave, sorted by
+// filter.OrderBy (recent, highest or lowest) and restricted to filter.FilterByGenre when set.
+// A perPage of 0 returns every rated movie.
+func (m *DbModel) GetUserRatings(userID int, filter MovieFilter, page, perPage int, opts MovieOptions) (*PaginatedMovies, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	order, ok := userRatingsOrder[filter.OrderBy]
+	if !ok {
+		order = userRatingsOrder["recent"]
+	}
+
+	where := `WHERE r.user_id = $1
+	AND ($2::int = 0 OR EXISTS (SELECT 1 FROM movies_genres mg WHERE mg.movie_id = r.movie_id AND mg.genre_id = $2))`
+
+	result := &PaginatedMovies{PerPage: perPage, CurrentPage: page, Movies: []*Movie{}}
+	err := m.Db.QueryRowContext(ctx, `SELECT COUNT(*) FROM ratings r `+where, userID, filter.FilterByGenre).Scan(&result.TotalCount)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := 0
+	if perPage > 0 {
+		offset = (page - 1) * perPage
+	}
+
+	// older ratings have no updated_at, they were last changed when they were created
+	query := `SELECT r.movie_id, r.rating, COALESCE(r.updated_at, r.created_at) AS rated_at FROM ratings r ` + where + `
+	ORDER BY ` + order + `
+	LIMIT $3 OFFSET $4`
+
+	rows, err := m.Db.QueryContext(ctx, query, userID, filter.FilterByGenre, limitArg(perPage), offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	scores := make(map[int]float64)
+	ratedAt := make(map[int]time.Time)
+	for rows.Next() {
+		var movieID int
+		var score float64
+		var updatedAt time.Time
+		err := rows.Scan(&movieID, &score, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, movieID)
+		scores[movieID] = score
+		ratedAt[movieID] = updatedAt
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	movies, err := m.GetMoviesByIDs(ids, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, movie := range movies {
+		score, at := scores[movie.ID], ratedAt[movie.ID]
+		movie.MyRating = &score
+		movie.RatedAt = &at
+	}
+	result.Movies = movies
+
+	return result, nil
+}
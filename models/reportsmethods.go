@@ -0,0 +1,355 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// the values a report can take
+var (
+	ReportTargets  = []string{"comment", "review", "user"}
+	ReportReasons  = []string{"spam", "harassment", "hate", "spoiler", "other"}
+	ReportStatuses = []string{"open", "triaged", "resolved", "dismissed"}
+)
+
+// ModerationActions are the decisions a moderator can take on a report. approve, hide and suspend resolve
+// the report, unsuspend is only taken directly on a user.
+var ModerationActions = []string{"triage", "resolve", "dismiss", "approve", "hide", "suspend"}
+
+// PendingActions are the decisions a moderator can take on content held for moderation, reject hides it
+var PendingActions = []string{"approve", "reject"}
+
+// PendingTargets are the kinds of content the moderation filter can hold back
+var PendingTargets = []string{"comment", "review"}
+
+// ErrDuplicateReport is returned when the user already reported the same target
+var ErrDuplicateReport = errors.New("you already reported this")
+
+// ErrInvalidAction is returned when a moderation action doesn't apply to the target
+var ErrInvalidAction = errors.New("this action does not apply to the target")
+
+const reportQuery = `SELECT rp.id, rp.reporter_id, COALESCE(u.name, ''), rp.target_type, rp.target_id, rp.reason, rp.details, rp.status,
+	rp.created_at, rp.updated_at
+	FROM reports rp
+	LEFT JOIN users u ON (u.id = rp.reporter_id)
+	`
+
+func scanReport(row rowScanner) (*Report, error) {
+	var report Report
+	err := row.Scan(
+		&report.ID,
+		&report.ReporterID,
+		&report.ReporterName,
+		&report.TargetType,
+		&report.TargetID,
+		&report.Reason,
+		&report.Details,
+		&report.Status,
+		&report.CreatedAt,
+		&report.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// queryRower runs single row queries, both *sql.DB and *sql.Tx are
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// targetAuthor returns the user behind a report target, the author of a comment or review or the user
+// itself. It returns sql.ErrNoRows when the target does not exist.
+func targetAuthor(ctx context.Context, q queryRower, targetType string, targetID int) (int, error) {
+	var query string
+	switch targetType {
+	case "comment":
+		query = `SELECT user_id FROM comments WHERE id = $1 AND deleted_at IS NULL`
+	case "review":
+		query = `SELECT user_id FROM reviews WHERE id = $1`
+	case "user":
+		query = `SELECT id FROM users WHERE id = $1`
+	default:
+		return 0, ErrInvalidAction
+	}
+
+	var userID int
+	err := q.QueryRowContext(ctx, query, targetID).Scan(&userID)
+	return userID, err
+}
+
+// InsertReport saves a new open report and sets its id. It returns sql.ErrNoRows when the target does not
+// exist and ErrDuplicateReport when the reporter already reported it.
+func (m *DbModel) InsertReport(report *Report) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := targetAuthor(ctx, m.Db, report.TargetType, report.TargetID)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO reports (reporter_id, target_type, target_id, reason, details, status, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, 'open', $6, $7)
+	RETURNING id, status`
+
+	err = m.Db.QueryRowContext(ctx, query,
+		report.ReporterID, report.TargetType, report.TargetID, report.Reason, report.Details, report.CreatedAt, report.UpdatedAt,
+	).Scan(&report.ID, &report.Status)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrDuplicateReport
+		}
+		return err
+	}
+
+	return nil
+}
+
+// GetReports returns a page of the moderation queue, oldest first so the reports are handled in order
+func (m *DbModel) GetReports(filter ReportFilter, page, perPage int) (*PaginatedReports, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	where := `WHERE ($1 = '' OR rp.status = $1) AND ($2 = '' OR rp.target_type = $2)`
+
+	result := &PaginatedReports{PerPage: perPage, CurrentPage: page, Reports: []*Report{}}
+	err := m.Db.QueryRowContext(ctx, `SELECT COUNT(*) FROM reports rp `+where, filter.Status, filter.TargetType).Scan(&result.TotalCount)
+	if err != nil {
+		return nil, err
+	}
+
+	query := reportQuery + where + `
+	ORDER BY rp.created_at, rp.id
+	LIMIT $3 OFFSET $4`
+
+	rows, err := m.Db.QueryContext(ctx, query, filter.Status, filter.TargetType, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		result.Reports = append(result.Reports, report)
+	}
+
+	return result, rows.Err()
+}
+
+// GetReport returns a report with the moderation actions taken on it, oldest first
+func (m *DbModel) GetReport(id int) (*Report, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	report, err := scanReport(m.Db.QueryRowContext(ctx, reportQuery+`WHERE rp.id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT a.id, a.report_id, a.moderator_id, COALESCE(u.name, ''), a.action, a.target_type, a.target_id, a.note, a.created_at
+	FROM moderation_actions a
+	LEFT JOIN users u ON (u.id = a.moderator_id)
+	WHERE a.report_id = $1
+	ORDER BY a.created_at, a.id`
+
+	rows, err := m.Db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report.Actions = []ModerationAction{}
+	for rows.Next() {
+		var action ModerationAction
+		err := rows.Scan(
+			&action.ID,
+			&action.ReportID,
+			&action.ModeratorID,
+			&action.ModeratorName,
+			&action.Action,
+			&action.TargetType,
+			&action.TargetID,
+			&action.Note,
+			&action.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		report.Actions = append(report.Actions, action)
+	}
+
+	return report, rows.Err()
+}
+
+// ApplyModerationAction carries out the decision of a moderator and records it. With a ReportID the target is
+// the one of the report, whose status follows the action, otherwise TargetType and TargetID are used.
+// It returns sql.ErrNoRows when the report or target does not exist and ErrInvalidAction when the action
+// doesn't apply to the target, like approving content that isn't pending without a report.
+func (m *DbModel) ApplyModerationAction(action *ModerationAction) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if action.ReportID != nil {
+		query := `SELECT target_type, target_id FROM reports WHERE id = $1 FOR UPDATE`
+		err = tx.QueryRowContext(ctx, query, *action.ReportID).Scan(&action.TargetType, &action.TargetID)
+		if err != nil {
+			return err
+		}
+	}
+
+	var movieID int
+	status := ""
+	switch action.Action {
+	case "triage":
+		status = "triaged"
+	case "resolve":
+		status = "resolved"
+	case "dismiss":
+		status = "dismissed"
+	case "approve", "hide", "reject":
+		status = "resolved"
+		contentStatus := StatusHidden
+		if action.Action == "approve" {
+			contentStatus = StatusPublished
+		}
+		// without a report the action comes from the pending queue, it must not publish hidden content
+		pendingOnly := ""
+		if action.ReportID == nil {
+			pendingOnly = ` AND status = 'pending'`
+		}
+		var query string
+		switch action.TargetType {
+		case "comment":
+			query = `UPDATE comments SET status = $1 WHERE id = $2 AND deleted_at IS NULL` + pendingOnly + ` RETURNING movie_id`
+		case "review":
+			query = `UPDATE reviews SET status = $1 WHERE id = $2` + pendingOnly + ` RETURNING movie_id`
+		default:
+			return ErrInvalidAction
+		}
+		err = tx.QueryRowContext(ctx, query, contentStatus, action.TargetID).Scan(&movieID)
+		if errors.Is(err, sql.ErrNoRows) && action.ReportID == nil {
+			// tell a missing target from one that isn't pending
+			if _, err := targetAuthor(ctx, tx, action.TargetType, action.TargetID); err != nil {
+				return err
+			}
+			return ErrInvalidAction
+		}
+		if err != nil {
+			return err
+		}
+	case "suspend", "unsuspend":
+		status = "resolved"
+		userID, err := targetAuthor(ctx, tx, action.TargetType, action.TargetID)
+		if err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, `UPDATE users SET suspended = $1, updated_at = $2 WHERE id = $3 AND user_type <> 'admin'`,
+			action.Action == "suspend", time.Now(), userID)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrInvalidAction
+		}
+	default:
+		return ErrInvalidAction
+	}
+
+	if action.ReportID != nil {
+		_, err = tx.ExecContext(ctx, `UPDATE reports SET status = $1, updated_at = $2 WHERE id = $3`, status, action.CreatedAt, *action.ReportID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `INSERT INTO moderation_actions (report_id, moderator_id, action, target_type, target_id, note, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id`
+	err = tx.QueryRowContext(ctx, query,
+		action.ReportID, action.ModeratorID, action.Action, action.TargetType, action.TargetID, action.Note, action.CreatedAt,
+	).Scan(&action.ID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	if movieID != 0 {
+		m.invalidateMovie(movieID)
+	}
+
+	return nil
+}
+
+// GetPendingContent returns a page of the comments and reviews held for moderation, oldest first.
+// targetType narrows the page to comments or reviews, empty returns both.
+func (m *DbModel) GetPendingContent(targetType string, page, perPage int) (*PaginatedPendingContent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pending := `SELECT 'comment' AS target_type, c.id, c.movie_id, c.user_id, '' AS title, c.comment AS body, c.created_at
+		FROM comments c
+		WHERE c.status = 'pending' AND c.deleted_at IS NULL AND $1 IN ('', 'comment')
+		UNION ALL
+		SELECT 'review', rv.id, rv.movie_id, rv.user_id, rv.title, rv.body, rv.created_at
+		FROM reviews rv
+		WHERE rv.status = 'pending' AND $1 IN ('', 'review')`
+
+	result := &PaginatedPendingContent{PerPage: perPage, CurrentPage: page, Content: []*PendingContent{}}
+	err := m.Db.QueryRowContext(ctx, `SELECT COUNT(*) FROM (`+pending+`) p`, targetType).Scan(&result.TotalCount)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT p.target_type, p.id, p.movie_id, p.user_id, COALESCE(u.name, ''), p.title, p.body, p.created_at
+	FROM (` + pending + `) p
+	LEFT JOIN users u ON (u.id = p.user_id)
+	ORDER BY p.created_at, p.target_type, p.id
+	LIMIT $2 OFFSET $3`
+
+	rows, err := m.Db.QueryContext(ctx, query, targetType, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var content PendingContent
+		err := rows.Scan(
+			&content.TargetType,
+			&content.TargetID,
+			&content.MovieID,
+			&content.UserID,
+			&content.UserName,
+			&content.Title,
+			&content.Body,
+			&content.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		result.Content = append(result.Content, &content)
+	}
+
+	return result, rows.Err()
+}
@@ -0,0 +1,269 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrDuplicateReview is returned when the user already reviewed the movie
+var ErrDuplicateReview = errors.New("you already reviewed this movie")
+
+// reviewsOrder maps the sorts of the review listings to their ORDER BY clause
+var reviewsOrder = map[string]string{
+	"helpful": "helpful_count DESC, rv.created_at DESC, rv.id DESC",
+	"recent":  "rv.created_at DESC, rv.id DESC",
+}
+
+// reviewQuery selects reviews in the order scanReview reads them, $1 is the user reading them
+const reviewQuery = `SELECT rv.id, rv.movie_id, rv.user_id, COALESCE(u.name, ''), rv.title, rv.body, rv.spoiler, rv.status, rv.rating_id, rt.rating,
+	(SELECT COUNT(*) FROM review_votes vt WHERE vt.review_id = rv.id) AS helpful_count,
+	EXISTS(SELECT 1 FROM review_votes vt WHERE vt.review_id = rv.id AND vt.user_id = $1) AS voted_helpful,
+	rv.created_at, rv.updated_at
+	FROM reviews rv
+	LEFT JOIN users u ON (u.id = rv.user_id)
+	LEFT JOIN ratings rt ON (rt.id = rv.rating_id)
+	`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanReview(row rowScanner) (*Review, error) {
+	var review Review
+	err := row.Scan(
+		&review.ID,
+		&review.MovieID,
+		&review.UserID,
+		&review.UserName,
+		&review.Title,
+		&review.Body,
+		&review.Spoiler,
+		&review.Status,
+		&review.RatingID,
+		&review.Rating,
+		&review.HelpfulCount,
+		&review.VotedHelpful,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+// GetReview returns a review, viewerID is the user reading it or 0
+func (m *DbModel) GetReview(id, viewerID int) (*Review, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.Db.QueryRowContext(ctx, reviewQuery+`WHERE rv.id = $2`, viewerID, id)
+	return scanReview(row)
+}
+
+// GetMovieReviews returns a page of the reviews of a movie sorted by helpful votes or recency.
+// It returns sql.ErrNoRows when the movie does not exist.
+func (m *DbModel) GetMovieReviews(movieID int, sort string, page, perPage, viewerID int) (*PaginatedReviews, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	exists, err := m.movieExists(ctx, movieID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+
+	order, ok := reviewsOrder[sort]
+	if !ok {
+		order = reviewsOrder["helpful"]
+	}
+
+	result := &PaginatedReviews{PerPage: perPage, CurrentPage: page, Reviews: []*Review{}}
+	err = m.Db.QueryRowContext(ctx, `SELECT COUNT(*) FROM reviews WHERE movie_id = $1 AND status = 'published'`, movieID).Scan(&result.TotalCount)
+	if err != nil {
+		return nil, err
+	}
+
+	query := reviewQuery + `WHERE rv.movie_id = $2 AND rv.status = 'published'
+	ORDER BY ` + order + `
+	LIMIT $3 OFFSET $4`
+
+	rows, err := m.Db.QueryContext(ctx, query, viewerID, movieID, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		result.Reviews = append(result.Reviews, review)
+	}
+
+	return result, rows.Err()
+}
+
+// InsertReview saves a new review and sets its id. A rating sent along is saved like InsertRating does and
+// linked to the review, neither is saved when the other fails. It returns ErrDuplicateReview when the user
+// already reviewed the movie and sql.ErrNoRows when the movie does not exist.
+func (m *DbModel) InsertReview(review *Review, rating *Rating) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if rating != nil {
+		_, err = upsertRating(ctx, tx, rating)
+		if err != nil {
+			return err
+		}
+		review.RatingID = &rating.ID
+	}
+
+	query := `INSERT INTO reviews (movie_id, user_id, rating_id, title, body, spoiler, status, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id`
+
+	err = tx.QueryRowContext(ctx, query,
+		review.MovieID, review.UserID, review.RatingID, review.Title, review.Body, review.Spoiler, review.Status, review.CreatedAt, review.UpdatedAt,
+	).Scan(&review.ID)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateReview
+		case isForeignKeyViolation(err):
+			return sql.ErrNoRows
+		}
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	if rating != nil {
+		m.invalidateMovie(review.MovieID)
+	}
+
+	return nil
+}
+
+// UpdateReview saves the title, body, spoiler flag, status and linked rating of a review. A rating sent
+// along is saved like InsertRating does and linked to the review, in the same transaction.
+func (m *DbModel) UpdateReview(review *Review, rating *Rating) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if rating != nil {
+		_, err = upsertRating(ctx, tx, rating)
+		if err != nil {
+			return err
+		}
+		review.RatingID = &rating.ID
+	}
+
+	query := `UPDATE reviews SET rating_id = $1, title = $2, body = $3, spoiler = $4, status = $5, updated_at = $6 WHERE id = $7`
+
+	result, err := tx.ExecContext(ctx, query, review.RatingID, review.Title, review.Body, review.Spoiler, review.Status, review.UpdatedAt, review.ID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	if rating != nil {
+		m.invalidateMovie(review.MovieID)
+	}
+
+	return nil
+}
+
+// DeleteReview deletes a review and its votes
+func (m *DbModel) DeleteReview(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.Db.ExecContext(ctx, `DELETE FROM reviews WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// VoteReviewHelpful records that a user found a review helpful, voting twice is a no-op.
+// It returns sql.ErrNoRows when the review does not exist.
+func (m *DbModel) VoteReviewHelpful(reviewID, userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO review_votes (review_id, user_id, created_at, updated_at) VALUES ($1, $2, $3, $3)
+	ON CONFLICT (review_id, user_id) DO NOTHING`
+
+	_, err := m.Db.ExecContext(ctx, query, reviewID, userID, time.Now())
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return sql.ErrNoRows
+		}
+		return err
+	}
+
+	return nil
+}
+
+// UnvoteReviewHelpful removes the helpful vote of a user, sql.ErrNoRows when there is none
+func (m *DbModel) UnvoteReviewHelpful(reviewID, userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.Db.ExecContext(ctx, `DELETE FROM review_votes WHERE review_id = $1 AND user_id = $2`, reviewID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
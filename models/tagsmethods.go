@@ -0,0 +1,298 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+// ErrDuplicateTag is returned when a tag with the same slug already exists
+var ErrDuplicateTag = errors.New("tag already exists")
+
+// Slugify turns a tag name into its url friendly slug, e.g. "Based on a True Story" => "based-on-a-true-story"
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern so s only matches itself
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// GetAllTags returns all the tags, optionally filtered by a search term on name and slug
+func (m *DbModel) GetAllTags(search string) ([]*Tag, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// the slug of a search made of punctuation only is empty, it would match every tag
+	query := `select id, name, slug, created_at, updated_at from tags
+	where $1 = '' or name ilike '%' || $1 || '%' escape '\' or ($2 <> '' and slug like '%' || $2 || '%')
+	order by name`
+
+	rows, err := m.Db.QueryContext(ctx, query, escapeLike(search), Slugify(search))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*Tag{}
+	for rows.Next() {
+		var tag Tag
+		err := rows.Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.CreatedAt, &tag.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// GetTagBySlug returns the tag with the given slug
+func (m *DbModel) GetTagBySlug(slug string) (*Tag, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select id, name, slug, created_at, updated_at from tags where slug = $1`
+
+	var tag Tag
+	err := m.Db.QueryRowContext(ctx, query, slug).Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.CreatedAt, &tag.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tag, nil
+}
+
+// InsertTag creates a new tag, the slug is generated from the name
+func (m *DbModel) InsertTag(name string) (*Tag, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `insert into tags (name, slug, created_at, updated_at) values ($1, $2, $3, $4) returning id`
+
+	tag := Tag{
+		Name:      strings.TrimSpace(name),
+		Slug:      Slugify(name),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	err := m.Db.QueryRowContext(ctx, query, tag.Name, tag.Slug, tag.CreatedAt, tag.UpdatedAt).Scan(&tag.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrDuplicateTag
+		}
+		return nil, err
+	}
+
+	return &tag, nil
+}
+
+// UpdateTag renames a tag and regenerates its slug
+func (m *DbModel) UpdateTag(id int, name string) (*Tag, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update tags set name = $1, slug = $2, updated_at = $3 where id = $4
+	returning id, name, slug, created_at, updated_at`
+
+	var tag Tag
+	err := m.Db.QueryRowContext(ctx, query, strings.TrimSpace(name), Slugify(name), time.Now(), id).
+		Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.CreatedAt, &tag.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrDuplicateTag
+		}
+		return nil, err
+	}
+
+	m.invalidateCatalog()
+
+	return &tag, nil
+}
+
+// DeleteTag deletes a tag, the movie links are removed by the cascade.
+// It returns sql.ErrNoRows when the tag does not exist.
+func (m *DbModel) DeleteTag(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.Db.ExecContext(ctx, `delete from tags where id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	m.invalidateCatalog()
+
+	return nil
+}
+
+// SetMovieTags replaces the tags of a movie with the given ones
+func (m *DbModel) SetMovieTags(movieID int, tagIDs []int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	exists, err := m.movieExists(ctx, movieID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	tx, err := m.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `delete from movies_tags where movie_id = $1`, movieID)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int64, 0, len(tagIDs))
+	for _, id := range tagIDs {
+		ids = append(ids, int64(id))
+	}
+
+	query := `insert into movies_tags (movie_id, tag_id, created_at, updated_at)
+	select $1, t.id, $3, $3 from tags t where t.id = any($2)`
+
+	result, err := tx.ExecContext(ctx, query, movieID, pq.Array(ids), time.Now())
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if int(inserted) != countUnique(tagIDs) {
+		return errors.New("one or more tags do not exist")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	m.invalidateMovie(movieID)
+
+	return nil
+}
+
+// GetMoviesByTag returns the movies tagged with the given slug
+func (m *DbModel) GetMoviesByTag(slug string, opts MovieOptions) ([]*Movie, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + movieColumns(opts.Fields) + `
+	FROM movies m
+	JOIN movies_tags mt ON (mt.movie_id = m.id)
+	JOIN tags t ON (t.id = mt.tag_id)
+	LEFT JOIN ratings r ON (r.movie_id = m.id)
+	WHERE t.slug = $1
+	GROUP BY m.id
+	ORDER BY m.title ASC`
+
+	rows, err := m.Db.QueryContext(ctx, query, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movies []*Movie
+	for rows.Next() {
+		movie, err := scanMovie(rows)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, movie)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = m.attachRelations(ctx, movies, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
+// attachTags loads the tags of all the given movies with a single query
+func (m *DbModel) attachTags(ctx context.Context, movies []*Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(movies))
+	byID := make(map[int]*Movie, len(movies))
+	for _, movie := range movies {
+		movie.Tags = []Tag{}
+		ids = append(ids, int64(movie.ID))
+		byID[movie.ID] = movie
+	}
+
+	query := `SELECT mt.movie_id, t.id, t.name, t.slug
+	FROM movies_tags mt
+	JOIN tags t ON (t.id = mt.tag_id)
+	WHERE mt.movie_id = ANY($1)
+	ORDER BY t.name`
+
+	rows, err := m.Db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movieID int
+		var tag Tag
+		err := rows.Scan(&movieID, &tag.ID, &tag.Name, &tag.Slug)
+		if err != nil {
+			return err
+		}
+		if movie, ok := byID[movieID]; ok {
+			movie.Tags = append(movie.Tags, tag)
+		}
+	}
+
+	return rows.Err()
+}
+
+// countUnique returns the number of distinct values in ids
+func countUnique(ids []int) int {
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	return len(seen)
+}
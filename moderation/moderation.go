@@ -0,0 +1,236 @@
+// Package moderation screens the text users post, comments and reviews, before it is published.
+package moderation
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/priyanshu-gupta07/MovieFlix-backend/validator"
+)
+
+// Verdict is the outcome of a check, a larger verdict is stricter
+type Verdict int
+
+const (
+	// Allow publishes the text right away
+	Allow Verdict = iota
+	// Review publishes the text once a moderator approved it
+	Review
+	// Reject refuses the text, the reasons are added to the validator
+	Reject
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Review:
+		return "review"
+	case Reject:
+		return "reject"
+	}
+	return "allow"
+}
+
+// Config holds the rules of a Filter, a limit of 0 disables its check
+type Config struct {
+	BlockedWords     []string      // words and phrases that get the text rejected
+	FlaggedWords     []string      // words and phrases that send the text to review
+	MaxLinks         int           // texts with more links are sent to review
+	MaxRepeatedChars int           // texts repeating a character more times in a row are rejected, like "!!!!!!!!!!"
+	MaxPosts         int           // posts a user can make within Window, the next ones are rejected
+	Window           time.Duration // the period MaxPosts applies to
+}
+
+// Filter checks texts against its Config. A nil Filter allows everything.
+// It is safe for concurrent use.
+type Filter struct {
+	config  Config
+	blocked []string
+	flagged []string
+
+	mu    sync.Mutex
+	posts map[int][]time.Time // recent post times of each user, oldest first
+	now   func() time.Time    // the clock of the velocity check
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// New returns a Filter applying config
+func New(config Config) *Filter {
+	return &Filter{
+		config:  config,
+		blocked: normalizeList(config.BlockedWords),
+		flagged: normalizeList(config.FlaggedWords),
+		posts:   make(map[int][]time.Time),
+		now:     time.Now,
+	}
+}
+
+// LoadWordList reads a word list file, one word or phrase per line.
+// Blank lines and lines starting with # are skipped.
+func LoadWordList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+
+	return words, scanner.Err()
+}
+
+// CheckText checks the text sent under key. The reasons of a rejection are added to v,
+// a text sent to review passes the validator.
+func (f *Filter) CheckText(v *validator.Validator, key, text string) Verdict {
+	if f == nil {
+		return Allow
+	}
+
+	normalized := normalize(text)
+
+	if containsWord(normalized, f.blocked) {
+		v.AddError(key, fmt.Sprintf("%s contains words that are not allowed", key))
+		return Reject
+	}
+
+	if f.config.MaxRepeatedChars > 0 && longestRun(text) > f.config.MaxRepeatedChars {
+		v.AddError(key, fmt.Sprintf("%s can't repeat a character more than %d times in a row", key, f.config.MaxRepeatedChars))
+		return Reject
+	}
+
+	if containsWord(normalized, f.flagged) {
+		return Review
+	}
+
+	if f.config.MaxLinks > 0 && len(linkPattern.FindAllString(text, -1)) > f.config.MaxLinks {
+		return Review
+	}
+
+	return Allow
+}
+
+// Reserve rejects the post of a user who posted MaxPosts times within the Window, and otherwise counts
+// the post right away, under the same lock, so concurrent posts can't all slip under the limit.
+// A post that fails to be saved gives its reservation back with Release.
+func (f *Filter) Reserve(v *validator.Validator, key string, userID int) Verdict {
+	if f == nil || f.config.MaxPosts <= 0 {
+		return Allow
+	}
+
+	now := f.now()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	posts := f.recentPosts(userID, now)
+	if len(posts) >= f.config.MaxPosts {
+		v.AddError(key, "you are posting too fast, please try again later")
+		return Reject
+	}
+	f.posts[userID] = append(posts, now)
+
+	// drop the users who stopped posting
+	since := now.Add(-f.config.Window)
+	for id, times := range f.posts {
+		if len(times) > 0 && !times[len(times)-1].After(since) {
+			delete(f.posts, id)
+		}
+	}
+
+	return Allow
+}
+
+// Release gives back the latest reservation of the user, when the post it was made for wasn't saved
+func (f *Filter) Release(userID int) {
+	if f == nil || f.config.MaxPosts <= 0 {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	posts := f.posts[userID]
+	switch len(posts) {
+	case 0:
+	case 1:
+		delete(f.posts, userID)
+	default:
+		f.posts[userID] = posts[:len(posts)-1]
+	}
+}
+
+// recentPosts drops the posts of the user out of the window and returns the others, f.mu must be held
+func (f *Filter) recentPosts(userID int, now time.Time) []time.Time {
+	since := now.Add(-f.config.Window)
+	posts := f.posts[userID]
+	for len(posts) > 0 && !posts[0].After(since) {
+		posts = posts[1:]
+	}
+	if len(posts) == 0 {
+		delete(f.posts, userID)
+		return nil
+	}
+	f.posts[userID] = posts
+	return posts
+}
+
+// normalize lowercases text and keeps its words separated by single spaces, with a space on both
+// ends so whole words and phrases can be found with strings.Contains
+func normalize(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return " " + strings.Join(words, " ") + " "
+}
+
+func normalizeList(words []string) []string {
+	list := make([]string, 0, len(words))
+	for _, word := range words {
+		if normalized := normalize(word); strings.TrimSpace(normalized) != "" {
+			list = append(list, normalized)
+		}
+	}
+	return list
+}
+
+// containsWord reports whether one of the words of list is in the normalized text
+func containsWord(normalized string, list []string) bool {
+	for _, word := range list {
+		if strings.Contains(normalized, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// longestRun returns the length of the longest run of the same character, white space aside
+func longestRun(text string) int {
+	longest, run := 0, 0
+	var previous rune
+	for _, r := range text {
+		if r == previous && !unicode.IsSpace(r) {
+			run++
+		} else {
+			run = 1
+		}
+		previous = r
+		if run > longest {
+			longest = run
+		}
+	}
+	return longest
+}
@@ -0,0 +1,262 @@
+package moderation
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/priyanshu-gupta07/MovieFlix-backend/validator"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", "  "},
+		{"Hello", " hello "},
+		{"  Hello,   WORLD!! ", " hello world "},
+		{"don't-stop_me", " don t stop me "},
+		{"Ünïcode Straße 42", " ünïcode straße 42 "},
+		{"...!?", "  "},
+	}
+
+	for _, tt := range tests {
+		if got := normalize(tt.text); got != tt.want {
+			t.Errorf("normalize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeList(t *testing.T) {
+	got := normalizeList([]string{"Spam", "  ", "!!", "Buy NOW"})
+	want := []string{" spam ", " buy now "}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("normalizeList() = %q, want %q", got, want)
+	}
+}
+
+func TestContainsWord(t *testing.T) {
+	list := normalizeList([]string{"spam", "buy now"})
+
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"spam", true},
+		{"This is SPAM!", true},
+		{"spam, at the start", true},
+		{"at the end: spam", true},
+		{"no spamming here", false},
+		{"antispam works", false},
+		{"Buy now, pay later", true},
+		{"buy   NOW", true},
+		{"buy-now", true},
+		{"buy nowhere", false},
+		{"rebuy now", false},
+		{"buy, then now", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := containsWord(normalize(tt.text), list); got != tt.want {
+			t.Errorf("containsWord(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+
+	if containsWord(normalize("anything"), nil) {
+		t.Errorf("containsWord() with an empty list = true, want false")
+	}
+}
+
+func TestLongestRun(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"abc", 1},
+		{"aab", 2},
+		{"wow!!!!!", 5},
+		{"noooooo way", 6},
+		{"a          b", 1},
+		{"ééé", 3},
+		{"aaAA", 2},
+	}
+
+	for _, tt := range tests {
+		if got := longestRun(tt.text); got != tt.want {
+			t.Errorf("longestRun(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCheckText(t *testing.T) {
+	f := New(Config{
+		BlockedWords:     []string{"slur"},
+		FlaggedWords:     []string{"free money"},
+		MaxLinks:         1,
+		MaxRepeatedChars: 4,
+	})
+
+	tests := []struct {
+		text      string
+		want      Verdict
+		wantError bool
+	}{
+		{"A fine movie", Allow, false},
+		{"what a SLUR", Reject, true},
+		{"slurp is fine", Allow, false},
+		{"Great!!!!", Allow, false},
+		{"Great!!!!!", Reject, true},
+		{"get FREE money", Review, false},
+		{"see https://example.com", Allow, false},
+		{"see https://example.com and www.example.org", Review, false},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		got := f.CheckText(v, "comment", tt.text)
+		if got != tt.want {
+			t.Errorf("CheckText(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+		if v.Valid() == tt.wantError {
+			t.Errorf("CheckText(%q) errors = %v, want errors: %v", tt.text, v.Errors, tt.wantError)
+		}
+	}
+
+	var nilFilter *Filter
+	if got := nilFilter.CheckText(validator.New(), "comment", "slur"); got != Allow {
+		t.Errorf("CheckText() on a nil filter = %v, want allow", got)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	f := New(Config{MaxPosts: 2, Window: time.Minute})
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+
+	reserve := func(userID int) Verdict {
+		t.Helper()
+		v := validator.New()
+		verdict := f.Reserve(v, "post", userID)
+		if (verdict == Reject) == v.Valid() {
+			t.Errorf("Reserve() = %v with errors %v", verdict, v.Errors)
+		}
+		return verdict
+	}
+
+	if got := reserve(1); got != Allow {
+		t.Fatalf("first post = %v, want allow", got)
+	}
+	now = now.Add(20 * time.Second)
+	if got := reserve(1); got != Allow {
+		t.Fatalf("second post = %v, want allow", got)
+	}
+
+	if got := reserve(1); got != Reject {
+		t.Errorf("after %d posts = %v, want reject", 2, got)
+	}
+	if got := reserve(2); got != Allow {
+		t.Errorf("another user = %v, want allow", got)
+	}
+
+	// a rejected post doesn't count, the first post leaves the window exactly a minute after it was made
+	now = now.Add(40 * time.Second)
+	if got := reserve(1); got != Allow {
+		t.Errorf("once the first post left the window = %v, want allow", got)
+	}
+	if got := reserve(1); got != Reject {
+		t.Errorf("after a new post = %v, want reject", got)
+	}
+
+	// a post that failed to be saved gives its reservation back
+	f.Release(1)
+	if got := reserve(1); got != Allow {
+		t.Errorf("after a release = %v, want allow", got)
+	}
+
+	// users without a post in the window are forgotten
+	now = now.Add(2 * time.Minute)
+	reserve(3)
+	if _, ok := f.posts[1]; ok {
+		t.Errorf("posts of user 1 were kept after the window")
+	}
+	if _, ok := f.posts[2]; ok {
+		t.Errorf("posts of user 2 were kept after the window")
+	}
+	if got := len(f.posts[3]); got != 1 {
+		t.Errorf("user 3 has %d posts, want 1", got)
+	}
+
+	f.Release(3)
+	f.Release(3)
+	if _, ok := f.posts[3]; ok {
+		t.Errorf("posts of user 3 were kept after releasing them all")
+	}
+}
+
+func TestReserveConcurrent(t *testing.T) {
+	f := New(Config{MaxPosts: 5, Window: time.Minute})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if f.Reserve(validator.New(), "post", 1) == Allow {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 5 {
+		t.Errorf("%d concurrent posts were allowed, want 5", allowed)
+	}
+}
+
+func TestReserveDisabled(t *testing.T) {
+	f := New(Config{Window: time.Minute})
+	for i := 0; i < 10; i++ {
+		if got := f.Reserve(validator.New(), "post", 1); got != Allow {
+			t.Fatalf("Reserve() without MaxPosts = %v, want allow", got)
+		}
+	}
+	f.Release(1)
+
+	var nilFilter *Filter
+	nilFilter.Release(1)
+	if got := nilFilter.Reserve(validator.New(), "post", 1); got != Allow {
+		t.Errorf("Reserve() on a nil filter = %v, want allow", got)
+	}
+}
+
+func TestLoadWordList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	err := os.WriteFile(path, []byte("# blocked words\nspam\n\n  buy now  \n#comment\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	words, err := LoadWordList(path)
+	if err != nil {
+		t.Fatalf("LoadWordList() error = %v", err)
+	}
+	if want := []string{"spam", "buy now"}; !reflect.DeepEqual(words, want) {
+		t.Errorf("LoadWordList() = %q, want %q", words, want)
+	}
+
+	_, err = LoadWordList(filepath.Join(t.TempDir(), "missing.txt"))
+	if err == nil {
+		t.Errorf("LoadWordList() of a missing file returned no error")
+	}
+}
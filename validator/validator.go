@@ -2,6 +2,7 @@ package validator
 
 import (
 	"fmt"
+	"math"
 	"regexp"
 	"strings"
 	"unicode"
@@ -31,9 +32,20 @@ func (v *Validator) Check(ok bool, key, message string) {
 	}
 }
 
+// In reports whether value is one of the given values
+func In(value string, list ...string) bool {
+	for _, item := range list {
+		if value == item {
+			return true
+		}
+	}
+	return false
+}
+
+// Required checks data is not empty or only made of white space
 func (v *Validator) Required(data, key, message string) {
-	if len(strings.Trim(data, "")) <= 0 {
-		v.AddError("key", message)
+	if strings.TrimSpace(data) == "" {
+		v.AddError(key, message)
 	}
 }
 
@@ -57,6 +69,13 @@ func (v *Validator) IsEmail(email, key, message string) {
 	}
 }
 
+// IsRating checks a rating is between 0.5 and 5 in steps of 0.5
+func (v *Validator) IsRating(rating float64, key string) {
+	if rating < 0.5 || rating > 5 || rating*2 != math.Trunc(rating*2) {
+		v.AddError(key, fmt.Sprintf("%s must be between 0.5 and 5 in steps of 0.5", key))
+	}
+}
+
 // isValidPassword validates the password with the given key
 func (v *Validator) IsValidPassword(password, key string, minLength ...int) {
 	// Set initial flags to false